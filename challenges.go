@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	logf "github.com/jetstack/cert-manager/pkg/logs"
+)
+
+// challengeRecord identifies the Dynu TXT record created for a challenge
+type challengeRecord struct {
+	DomainID int    `json:"domainId"`
+	RecordID int    `json:"recordId"`
+	FQDN     string `json:"fqdn"`
+}
+
+// challengeStore remembers which Dynu record was created for each
+// challenge, so CleanUp can delete it by ID instead of searching for it.
+// It is safe for concurrent use; a nil store behaves as an empty one.
+type challengeStore struct {
+	lock    sync.Mutex
+	records map[string]challengeRecord
+	// persister optionally mirrors the records so they survive restarts
+	persister challengePersister
+}
+
+func newChallengeStore(persister challengePersister) *challengeStore {
+	return &challengeStore{records: map[string]challengeRecord{}, persister: persister}
+}
+
+// challengeKey identifies a challenge by its FQDN and key. The request UID
+// can't be used: cert-manager sets a new one for each webhook call, so
+// Present and CleanUp never share it.
+func challengeKey(ch *v1alpha1.ChallengeRequest) string {
+	return ch.ResolvedFQDN + "/" + ch.Key
+}
+
+// Load reads previously persisted records into memory
+func (s *challengeStore) Load(ctx context.Context) error {
+	if s == nil || s.persister == nil {
+		return nil
+	}
+	records, err := s.persister.Load(ctx)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key, rec := range records {
+		s.records[key] = rec
+	}
+	activeChallengeRecords.Set(float64(len(s.records)))
+	logger.V(logf.InfoLevel).Info("loaded persisted challenge records", "count", len(records))
+	return nil
+}
+
+func (s *challengeStore) Get(key string) (challengeRecord, bool) {
+	if s == nil {
+		return challengeRecord{}, false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rec, ok := s.records[key]
+	return rec, ok
+}
+
+// Put records rec for key. Failing to persist it is logged but not fatal,
+// since CleanUp can still find the record by searching Dynu.
+func (s *challengeStore) Put(ctx context.Context, key string, rec challengeRecord) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.records[key] = rec
+	activeChallengeRecords.Set(float64(len(s.records)))
+	s.lock.Unlock()
+	if s.persister != nil {
+		if err := s.persister.Save(ctx, key, rec); err != nil {
+			logger.Error(err, "failed to persist challenge record", "key", key)
+		}
+	}
+}
+
+func (s *challengeStore) Delete(ctx context.Context, key string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	delete(s.records, key)
+	activeChallengeRecords.Set(float64(len(s.records)))
+	s.lock.Unlock()
+	if s.persister != nil {
+		if err := s.persister.Delete(ctx, key); err != nil {
+			logger.Error(err, "failed to delete persisted challenge record", "key", key)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	logf "github.com/jetstack/cert-manager/pkg/logs"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// challengePersister saves challenge records outside the process, so CleanUp
+// can still delete by ID after the webhook restarts
+type challengePersister interface {
+	Load(ctx context.Context) (map[string]challengeRecord, error)
+	Save(ctx context.Context, key string, rec challengeRecord) error
+	Delete(ctx context.Context, key string) error
+}
+
+// challengeStateMaxAge is how long a ConfigMap entry is kept. Entries are
+// normally deleted by CleanUp, but a challenge that never gets cleaned up
+// would otherwise stay forever; by this age cert-manager has given up on it.
+const challengeStateMaxAge = 7 * 24 * time.Hour
+
+// configMapPersister keeps one ConfigMap entry per challenge, pruning entries
+// older than maxAge whenever it writes
+type configMapPersister struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	maxAge    time.Duration
+	now       func() time.Time
+}
+
+// persistedChallenge is the JSON stored in a ConfigMap entry. The store key
+// is kept alongside the record because it isn't always a valid data key.
+type persistedChallenge struct {
+	Key     string    `json:"key"`
+	Created time.Time `json:"created"`
+	challengeRecord
+}
+
+var configMapKeyRegexp = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// configMapKey turns a challenge key into a valid ConfigMap data key
+func configMapKey(key string) string {
+	if len(key) <= 253 && configMapKeyRegexp.MatchString(key) {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256-" + hex.EncodeToString(sum[:])
+}
+
+func newConfigMapPersister(client kubernetes.Interface, namespace, name string) *configMapPersister {
+	return &configMapPersister{client: client, namespace: namespace, name: name, maxAge: challengeStateMaxAge, now: time.Now}
+}
+
+func (p *configMapPersister) Load(ctx context.Context) (map[string]challengeRecord, error) {
+	records := map[string]challengeRecord{}
+	cm, err := p.client.CoreV1().ConfigMaps(p.namespace).Get(ctx, p.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load challenge state from configmap %s/%s: %v", p.namespace, p.name, err)
+	}
+	for dataKey, v := range cm.Data {
+		var entry persistedChallenge
+		if err := json.Unmarshal([]byte(v), &entry); err != nil {
+			return nil, fmt.Errorf("invalid entry %q in configmap %s/%s: %v", dataKey, p.namespace, p.name, err)
+		}
+		records[entry.Key] = entry.challengeRecord
+	}
+	return records, nil
+}
+
+func (p *configMapPersister) Save(ctx context.Context, key string, rec challengeRecord) error {
+	v, err := json.Marshal(persistedChallenge{Key: key, Created: p.now().UTC(), challengeRecord: rec})
+	if err != nil {
+		return err
+	}
+	return p.update(ctx, func(data map[string]string) {
+		data[configMapKey(key)] = string(v)
+	})
+}
+
+func (p *configMapPersister) Delete(ctx context.Context, key string) error {
+	return p.update(ctx, func(data map[string]string) {
+		delete(data, configMapKey(key))
+	})
+}
+
+// prune drops the entries older than maxAge. Entries without a timestamp,
+// or that can't be read, are dropped too.
+func (p *configMapPersister) prune(data map[string]string) {
+	cutoff := p.now().Add(-p.maxAge)
+	for dataKey, v := range data {
+		var entry persistedChallenge
+		if err := json.Unmarshal([]byte(v), &entry); err != nil || entry.Created.Before(cutoff) {
+			logger.V(logf.DebugLevel).Info("pruning stale challenge record", "configMap", p.namespace+"/"+p.name, "key", dataKey)
+			delete(data, dataKey)
+		}
+	}
+}
+
+// update applies mutate to the ConfigMap's data and prunes stale entries,
+// creating the ConfigMap if needed and retrying on write conflicts with other
+// replicas
+func (p *configMapPersister) update(ctx context.Context, mutate func(map[string]string)) error {
+	configMaps := p.client.CoreV1().ConfigMaps(p.namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, p.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: p.name, Namespace: p.namespace},
+				Data:       map[string]string{},
+			}
+			mutate(cm.Data)
+			p.prune(cm.Data)
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// another replica created it first; retry as an update
+				return apierrors.NewConflict(corev1.Resource("configmaps"), p.name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		mutate(cm.Data)
+		p.prune(cm.Data)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update challenge state in configmap %s/%s: %v", p.namespace, p.name, err)
+	}
+	return nil
+}
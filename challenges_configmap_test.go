@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapKey(t *testing.T) {
+	assert.Equal(t, "4f1c3a2e-uid", configMapKey("4f1c3a2e-uid"))
+
+	key := configMapKey("_acme-challenge.example.com./abc+/def==")
+	assert.True(t, strings.HasPrefix(key, "sha256-"), key)
+	assert.Regexp(t, configMapKeyRegexp, key)
+	assert.Equal(t, key, configMapKey("_acme-challenge.example.com./abc+/def=="))
+}
+
+func TestConfigMapPersisterSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+
+	before := newChallengeStore(newConfigMapPersister(client, "cert-manager", "dynu-challenges"))
+	assert.NoError(t, before.Load(ctx), "a missing configmap should load as empty")
+	before.Put(ctx, "uid-1", challengeRecord{DomainID: 1, RecordID: 10, FQDN: "_acme-challenge.a.example.com."})
+	before.Put(ctx, "_acme-challenge.b.example.com./k+/==", challengeRecord{DomainID: 1, RecordID: 11})
+	before.Put(ctx, "uid-3", challengeRecord{DomainID: 2, RecordID: 12})
+	before.Delete(ctx, "uid-3")
+
+	cm, err := client.CoreV1().ConfigMaps("cert-manager").Get(ctx, "dynu-challenges", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, cm.Data, 2)
+
+	after := newChallengeStore(newConfigMapPersister(client, "cert-manager", "dynu-challenges"))
+	assert.NoError(t, after.Load(ctx))
+
+	rec, ok := after.Get("uid-1")
+	assert.True(t, ok)
+	assert.Equal(t, challengeRecord{DomainID: 1, RecordID: 10, FQDN: "_acme-challenge.a.example.com."}, rec)
+	rec, ok = after.Get("_acme-challenge.b.example.com./k+/==")
+	assert.True(t, ok)
+	assert.Equal(t, 11, rec.RecordID)
+	_, ok = after.Get("uid-3")
+	assert.False(t, ok)
+}
+
+func TestConfigMapPersisterPrunesStaleEntries(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	persister := newConfigMapPersister(client, "cert-manager", "dynu-challenges")
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	persister.now = func() time.Time { return now }
+
+	assert.NoError(t, persister.Save(ctx, "uid-old", challengeRecord{DomainID: 1, RecordID: 10}))
+	now = now.Add(challengeStateMaxAge)
+	assert.NoError(t, persister.Save(ctx, "uid-recent", challengeRecord{DomainID: 1, RecordID: 11}))
+	records, err := persister.Load(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2, "an entry exactly maxAge old should be kept")
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, persister.Delete(ctx, "uid-unknown"))
+	records, err = persister.Load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]challengeRecord{"uid-recent": {DomainID: 1, RecordID: 11}}, records, "entries older than maxAge should be pruned on write")
+
+	cm, err := client.CoreV1().ConfigMaps("cert-manager").Get(ctx, "dynu-challenges", metav1.GetOptions{})
+	assert.NoError(t, err)
+	cm.Data["uid-legacy"] = `{"key": "uid-legacy", "domainId": 1, "recordId": 12}`
+	_, err = client.CoreV1().ConfigMaps("cert-manager").Update(ctx, cm, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, persister.Save(ctx, "uid-new", challengeRecord{DomainID: 1, RecordID: 13}))
+	records, err = persister.Load(ctx)
+	assert.NoError(t, err)
+	assert.NotContains(t, records, "uid-legacy", "entries without a timestamp should be pruned")
+	assert.Contains(t, records, "uid-new")
+}
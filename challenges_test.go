@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+// unlimited keeps tests against dynutest from waiting on the default Dynu
+// rate limit
+var unlimited = rate.NewLimiter(rate.Inf, 1)
+
+func TestChallengeStoreConcurrent(t *testing.T) {
+	s := newChallengeStore(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("uid-%d", i)
+			s.Put(context.Background(), key, challengeRecord{DomainID: 1, RecordID: i})
+			rec, ok := s.Get(key)
+			assert.True(t, ok)
+			assert.Equal(t, i, rec.RecordID)
+			s.Delete(context.Background(), key)
+		}(i)
+	}
+	wg.Wait()
+	assert.Empty(t, s.records)
+
+	var nilStore *challengeStore
+	nilStore.Put(context.Background(), "uid", challengeRecord{})
+	_, ok := nilStore.Get("uid")
+	assert.False(t, ok)
+}
+
+func TestChallengeKey(t *testing.T) {
+	assert.Equal(t, "a.example.com./k", challengeKey(&v1alpha1.ChallengeRequest{UID: "abc", ResolvedFQDN: "a.example.com.", Key: "k"}))
+	assert.Equal(t, challengeKey(&v1alpha1.ChallengeRequest{UID: "abc", ResolvedFQDN: "a.example.com.", Key: "k"}),
+		challengeKey(&v1alpha1.ChallengeRequest{UID: "def", ResolvedFQDN: "a.example.com.", Key: "k"}),
+		"Present and CleanUp of one challenge carry different UIDs")
+}
+
+func TestCleanUpDeletesTrackedRecord(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+
+	solver := &dynuProviderSolver{challenges: newChallengeStore(nil), limiter: unlimited}
+	ch := &v1alpha1.ChallengeRequest{
+		UID:          "present-uid",
+		ResolvedFQDN: "_acme-challenge.www.example.com.",
+		ResolvedZone: "example.com.",
+		Key:          "123d==",
+		Config:       &extapi.JSON{Raw: []byte(fmt.Sprintf(`{"apiKey": %q, "ttl": 60, "apiBaseURL": %q}`, api.APIKey, api.URL))},
+	}
+
+	assert.NoError(t, solver.Present(ch))
+	recs := api.Records()
+	if !assert.Len(t, recs, 1) {
+		return
+	}
+	assert.Equal(t, "_acme-challenge.www", recs[0].NodeName)
+	rec, ok := solver.challenges.Get(challengeKey(ch))
+	assert.True(t, ok)
+	assert.Equal(t, challengeRecord{DomainID: recs[0].DomainID, RecordID: recs[0].ID, FQDN: ch.ResolvedFQDN}, rec)
+
+	// cert-manager sends each webhook call with its own UID
+	cleanUp := *ch
+	cleanUp.UID = "cleanup-uid"
+	before := len(api.Requests())
+	assert.NoError(t, solver.CleanUp(&cleanUp))
+	assert.Equal(t, []string{fmt.Sprintf("DELETE /v2/dns/%d/record/%d", rec.DomainID, rec.RecordID)}, api.Requests()[before:],
+		"CleanUp should delete a tracked record without looking it up")
+	assert.Empty(t, api.Records())
+	_, ok = solver.challenges.Get(challengeKey(ch))
+	assert.False(t, ok)
+}
+
+func TestCleanUpFindsUntrackedRecord(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+
+	ch := &v1alpha1.ChallengeRequest{
+		UID:          "challenge-uid",
+		ResolvedFQDN: "_acme-challenge.a.b.example.com.",
+		ResolvedZone: "example.com.",
+		Key:          "123d==",
+		Config:       &extapi.JSON{Raw: []byte(fmt.Sprintf(`{"apiKey": %q, "ttl": 60, "apiBaseURL": %q}`, api.APIKey, api.URL))},
+	}
+	// Present and CleanUp run in different processes, e.g. across a restart
+	assert.NoError(t, (&dynuProviderSolver{challenges: newChallengeStore(nil), limiter: unlimited}).Present(ch))
+	assert.Len(t, api.Records(), 1)
+	assert.NoError(t, (&dynuProviderSolver{challenges: newChallengeStore(nil), limiter: unlimited}).CleanUp(ch))
+	assert.Empty(t, api.Records())
+}
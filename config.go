@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynuclient"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// defaultTTL is the TTL of challenge records when the config sets none
+	defaultTTL = 300
+	// minTTL and maxTTL are the TTLs Dynu accepts
+	minTTL = 30
+	maxTTL = 86400
+)
+
+// configPath is where cert-manager takes the solver config from
+var configPath = field.NewPath("webhook", "config")
+
+// Validate fills in defaults, clamps the TTL into the range Dynu accepts and
+// checks that the config is usable. Errors name the offending field, e.g.
+// webhook.config.apikeySecretKeyRef.key.
+func (cfg *dynuProviderConfig) Validate() error {
+	var errs field.ErrorList
+
+	switch {
+	case cfg.TTL < 0:
+		errs = append(errs, field.Invalid(configPath.Child("ttl"), cfg.TTL, "must not be negative"))
+	case cfg.TTL == 0:
+		cfg.TTL = defaultTTL
+	case cfg.TTL < minTTL:
+		logger.Info("raising ttl to Dynu's minimum", "ttl", cfg.TTL, "minimum", minTTL)
+		cfg.TTL = minTTL
+	case cfg.TTL > maxTTL:
+		logger.Info("lowering ttl to Dynu's maximum", "ttl", cfg.TTL, "maximum", maxTTL)
+		cfg.TTL = maxTTL
+	}
+
+	errs = append(errs, cfg.validateCredentials()...)
+
+	if cfg.APIBaseURL != "" {
+		if err := dynuclient.ValidateBaseURL(cfg.APIBaseURL); err != nil {
+			errs = append(errs, field.Invalid(configPath.Child("apiBaseURL"), cfg.APIBaseURL, err.Error()))
+		}
+	}
+	// zero means the process-wide default, which was validated at startup
+	if cfg.RateLimit < 0 {
+		errs = append(errs, field.Invalid(configPath.Child("rateLimit"), cfg.RateLimit, "must be greater than 0"))
+	}
+	if cfg.RateBurst < 0 {
+		errs = append(errs, field.Invalid(configPath.Child("rateBurst"), cfg.RateBurst, "must be at least 1"))
+	}
+
+	return errs.ToAggregate()
+}
+
+// validateCredentials checks that exactly one way of authenticating is
+// configured
+func (cfg *dynuProviderConfig) validateCredentials() field.ErrorList {
+	var errs field.ErrorList
+	var set []string
+	if cfg.APIKey != "" {
+		set = append(set, "apiKey")
+	}
+	if cfg.APIKeySecretKeyRef != (secretKeySelector{}) {
+		set = append(set, "apikeySecretKeyRef")
+		errs = append(errs, validateSecretKeySelector(configPath.Child("apikeySecretKeyRef"), cfg.APIKeySecretKeyRef)...)
+	}
+	clientID := cfg.ClientIDSecretRef != (secretKeySelector{})
+	clientSecret := cfg.ClientSecretSecretRef != (secretKeySelector{})
+	if clientID || clientSecret {
+		set = append(set, "clientIdSecretRef")
+		switch {
+		case !clientID:
+			errs = append(errs, field.Required(configPath.Child("clientIdSecretRef"), "required with clientSecretSecretRef"))
+		case !clientSecret:
+			errs = append(errs, field.Required(configPath.Child("clientSecretSecretRef"), "required with clientIdSecretRef"))
+		}
+		if clientID {
+			errs = append(errs, validateSecretKeySelector(configPath.Child("clientIdSecretRef"), cfg.ClientIDSecretRef)...)
+		}
+		if clientSecret {
+			errs = append(errs, validateSecretKeySelector(configPath.Child("clientSecretSecretRef"), cfg.ClientSecretSecretRef)...)
+		}
+	}
+
+	if len(set) == 0 {
+		errs = append(errs, field.Required(configPath, "one of apiKey, apikeySecretKeyRef or clientIdSecretRef and clientSecretSecretRef is required"))
+	}
+	if len(set) > 1 {
+		for _, name := range set[1:] {
+			errs = append(errs, field.Forbidden(configPath.Child(name), fmt.Sprintf("may not be set together with %s", set[0])))
+		}
+	}
+	return errs
+}
+
+// validateSecretKeySelector checks that sel names a key of a Secret
+func validateSecretKeySelector(path *field.Path, sel secretKeySelector) field.ErrorList {
+	var errs field.ErrorList
+	if sel.Name == "" {
+		errs = append(errs, field.Required(path.Child("name"), "the name of the Secret"))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(sel.Name) {
+			errs = append(errs, field.Invalid(path.Child("name"), sel.Name, msg))
+		}
+	}
+	if sel.Key == "" {
+		errs = append(errs, field.Required(path.Child("key"), "the key of the value within the Secret"))
+	}
+	if sel.Namespace != "" {
+		for _, msg := range validation.IsDNS1123Label(sel.Namespace) {
+			errs = append(errs, field.Invalid(path.Child("namespace"), sel.Namespace, msg))
+		}
+	}
+	return errs
+}
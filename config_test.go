@@ -0,0 +1,157 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+func TestValidate(t *testing.T) {
+	ref := secretRef("dynu-credentials", "apikey")
+	tests := []struct {
+		name   string
+		cfg    dynuProviderConfig
+		ttl    int
+		errors []string
+	}{
+		{name: "api key", cfg: dynuProviderConfig{APIKey: "key", TTL: 60}, ttl: 60},
+		{name: "default ttl", cfg: dynuProviderConfig{APIKeySecretKeyRef: ref}, ttl: defaultTTL},
+		{name: "ttl raised", cfg: dynuProviderConfig{APIKey: "key", TTL: 5}, ttl: minTTL},
+		{name: "ttl lowered", cfg: dynuProviderConfig{APIKey: "key", TTL: 100000}, ttl: maxTTL},
+		{
+			name:   "negative ttl",
+			cfg:    dynuProviderConfig{APIKey: "key", TTL: -1},
+			ttl:    -1,
+			errors: []string{"webhook.config.ttl: Invalid value: -1: must not be negative"},
+		},
+		{
+			name: "oauth2",
+			cfg:  dynuProviderConfig{ClientIDSecretRef: secretRef("dynu-oauth", "id"), ClientSecretSecretRef: secretRef("dynu-oauth", "secret")},
+			ttl:  defaultTTL,
+		},
+		{
+			name:   "no credentials",
+			cfg:    dynuProviderConfig{},
+			ttl:    defaultTTL,
+			errors: []string{"webhook.config: Required value: one of apiKey, apikeySecretKeyRef or clientIdSecretRef and clientSecretSecretRef is required"},
+		},
+		{
+			name:   "api key and secret",
+			cfg:    dynuProviderConfig{APIKey: "key", APIKeySecretKeyRef: ref},
+			ttl:    defaultTTL,
+			errors: []string{"webhook.config.apikeySecretKeyRef: Forbidden: may not be set together with apiKey"},
+		},
+		{
+			name: "api key and oauth2",
+			cfg:  dynuProviderConfig{APIKeySecretKeyRef: ref, ClientIDSecretRef: secretRef("dynu-oauth", "id"), ClientSecretSecretRef: secretRef("dynu-oauth", "secret")},
+			ttl:  defaultTTL,
+			errors: []string{
+				"webhook.config.clientIdSecretRef: Forbidden: may not be set together with apikeySecretKeyRef",
+			},
+		},
+		{
+			name:   "client id only",
+			cfg:    dynuProviderConfig{ClientIDSecretRef: secretRef("dynu-oauth", "id")},
+			ttl:    defaultTTL,
+			errors: []string{"webhook.config.clientSecretSecretRef: Required value: required with clientIdSecretRef"},
+		},
+		{
+			name:   "client secret only",
+			cfg:    dynuProviderConfig{ClientSecretSecretRef: secretRef("dynu-oauth", "secret")},
+			ttl:    defaultTTL,
+			errors: []string{"webhook.config.clientIdSecretRef: Required value: required with clientSecretSecretRef"},
+		},
+		{
+			name:   "secret without key",
+			cfg:    dynuProviderConfig{APIKeySecretKeyRef: secretRef("dynu-credentials", "")},
+			ttl:    defaultTTL,
+			errors: []string{"webhook.config.apikeySecretKeyRef.key: Required value: the key of the value within the Secret"},
+		},
+		{
+			name:   "secret without name",
+			cfg:    dynuProviderConfig{APIKeySecretKeyRef: secretRef("", "apikey")},
+			ttl:    defaultTTL,
+			errors: []string{"webhook.config.apikeySecretKeyRef.name: Required value: the name of the Secret"},
+		},
+		{
+			name: "bad secret namespace",
+			cfg: dynuProviderConfig{APIKeySecretKeyRef: secretKeySelector{
+				SecretKeySelector: ref.SecretKeySelector,
+				Namespace:         "Dynu_Shared",
+			}},
+			ttl: defaultTTL,
+			errors: []string{
+				`webhook.config.apikeySecretKeyRef.namespace: Invalid value: "Dynu_Shared": a DNS-1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')`,
+			},
+		},
+		{
+			name:   "bad base url",
+			cfg:    dynuProviderConfig{APIKey: "key", APIBaseURL: "ftp://example.com"},
+			ttl:    defaultTTL,
+			errors: []string{"webhook.config.apiBaseURL: Invalid value"},
+		},
+		{
+			name: "bad rate limit",
+			cfg:  dynuProviderConfig{APIKey: "key", RateLimit: -1, RateBurst: -2},
+			ttl:  defaultTTL,
+			errors: []string{
+				"webhook.config.rateLimit: Invalid value: -1: must be greater than 0",
+				"webhook.config.rateBurst: Invalid value: -2: must be at least 1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			err := cfg.Validate()
+			assert.Equal(t, tt.ttl, cfg.TTL)
+			if len(tt.errors) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				for _, msg := range tt.errors {
+					assert.Contains(t, err.Error(), msg)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := loadConfig(&extapi.JSON{Raw: []byte(`{"apikeySecretKeyRef": {"name": "dynu-credentials", "key": "apikey"}}`)})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultTTL, cfg.TTL)
+	assert.Equal(t, "dynu-credentials", cfg.APIKeySecretKeyRef.Name)
+
+	_, err = loadConfig(&extapi.JSON{Raw: []byte(`{"apiKey": "key", "tll": 60}`)})
+	if assert.Error(t, err, "misspelt fields should be rejected") {
+		assert.Contains(t, err.Error(), `unknown field "tll"`)
+	}
+
+	_, err = loadConfig(&extapi.JSON{Raw: []byte(`{"apikeySecretKeyRef": {"name": "dynu-credentials", "key": "apikey", "optional": true}}`)})
+	assert.Error(t, err, "unknown fields of secret selectors should be rejected")
+
+	_, err = loadConfig(nil)
+	if assert.Error(t, err, "a missing config has no credentials") {
+		assert.Contains(t, err.Error(), "invalid solver config: webhook.config: Required value")
+	}
+
+	_, err = loadConfig(&extapi.JSON{Raw: []byte(`{"apiKey": "key", "ttl": "60"}`)})
+	assert.Error(t, err)
+}
+
+func TestIssuerRateLimit(t *testing.T) {
+	limit, burst := (&dynuProviderConfig{}).rateLimit()
+	assert.Equal(t, rateLimit, limit)
+	assert.Equal(t, rateBurst, burst)
+
+	limit, burst = (&dynuProviderConfig{RateLimit: rateLimit / 2, RateBurst: 1}).rateLimit()
+	assert.Equal(t, rateLimit/2, limit, "an issuer may lower the limit")
+	assert.Equal(t, 1, burst)
+
+	limit, burst = (&dynuProviderConfig{RateLimit: rateLimit * 100, RateBurst: rateBurst * 100}).rateLimit()
+	assert.Equal(t, rateLimit, limit, "an issuer may not raise the limit")
+	assert.Equal(t, rateBurst, burst)
+}
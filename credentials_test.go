@@ -0,0 +1,196 @@
+package main
+
+import (
+	b64 "encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynuclient"
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPresentWithOAuth2(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+	api.ClientID, api.ClientSecret = "client-id", "client-secret"
+
+	solver := &dynuProviderSolver{
+		client: fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "dynu-oauth", Namespace: "cert-manager"},
+			Data:       map[string][]byte{"id": []byte("client-id\n"), "secret": []byte("client-secret")},
+		}),
+		challenges: newChallengeStore(nil),
+		limiter:    unlimited,
+	}
+	ch := &v1alpha1.ChallengeRequest{
+		UID:               "challenge-uid",
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		ResourceNamespace: "cert-manager",
+		Key:               "123d==",
+		Config: &extapi.JSON{Raw: []byte(fmt.Sprintf(`{
+			"clientIdSecretRef": {"name": "dynu-oauth", "key": "id"},
+			"clientSecretSecretRef": {"name": "dynu-oauth", "key": "secret"},
+			"apiBaseURL": %q}`, api.URL))},
+	}
+
+	assert.NoError(t, solver.Present(ch))
+	assert.Equal(t, []string{"123d=="}, api.TXT(ch.ResolvedFQDN))
+	assert.Equal(t, "GET /v2/oauth2/token", api.Requests()[0])
+	assert.NoError(t, solver.CleanUp(ch))
+	assert.Empty(t, api.Records())
+
+	ch.Config = &extapi.JSON{Raw: []byte(`{"clientIdSecretRef": {"name": "dynu-oauth", "key": "id"}}`)}
+	assert.Error(t, solver.Present(ch), "a client ID without a secret should be rejected")
+	ch.Config = &extapi.JSON{Raw: []byte(`{
+		"clientIdSecretRef": {"name": "dynu-oauth", "key": "id"},
+		"clientSecretSecretRef": {"name": "dynu-oauth", "key": "missing"}}`)}
+	assert.Error(t, solver.Present(ch))
+}
+
+func TestGetCredentials(t *testing.T) {
+	// a made-up key shaped like a Dynu API key, which is valid base64 too
+	const apiKey = "fE3d6bU4V7W5e5T6c3V3b4ZeT3Tg4e2X"
+	secret := func(name, value string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cert-manager"},
+			Data:       map[string][]byte{"apikey": []byte(value)},
+		}
+	}
+	solver := &dynuProviderSolver{client: fake.NewSimpleClientset(
+		secret("raw", apiKey),
+		secret("raw-newline", apiKey+"\n"),
+		secret("legacy", b64.StdEncoding.EncodeToString([]byte(apiKey))),
+		secret("legacy-newline", b64.StdEncoding.EncodeToString([]byte(apiKey+"\n"))+"\n"),
+		secret("base64-binary", b64.StdEncoding.EncodeToString([]byte{0xde, 0xad, 0xbe, 0xef, 0x01, 0x02})),
+		secret("empty", " \n"),
+	)}
+	ref := func(name, key string) *dynuProviderConfig {
+		return &dynuProviderConfig{APIKeySecretKeyRef: secretRef(name, key)}
+	}
+
+	tests := []struct {
+		name   string
+		config *dynuProviderConfig
+		apiKey string
+		err    string
+	}{
+		{"raw key as created with stringData", ref("raw", "apikey"), apiKey, ""},
+		{"raw key with a trailing newline", ref("raw-newline", "apikey"), apiKey, ""},
+		{"legacy double-encoded key", ref("legacy", "apikey"), apiKey, ""},
+		{"legacy key encoded with a newline", ref("legacy-newline", "apikey"), apiKey, ""},
+		{"raw value that happens to be base64", ref("base64-binary", "apikey"), "3q2+7wEC", ""},
+		{"inline key", &dynuProviderConfig{APIKey: " " + apiKey + " "}, apiKey, ""},
+		{"missing secret", ref("missing", "apikey"), "", `failed to load secret "cert-manager/missing"`},
+		{"missing key", ref("raw", "api-key"), "", `no key "api-key" in secret "cert-manager/raw"`},
+		{"empty value", ref("empty", "apikey"), "", `key "apikey" in secret "cert-manager/empty" is empty`},
+		{"no key name", ref("raw", ""), "", `no key given for secret "cert-manager/raw"`},
+		{"nothing configured", &dynuProviderConfig{}, "", "no API key configured"},
+	}
+	for _, tt := range tests {
+		creds, err := solver.getCredentials(tt.config, "cert-manager")
+		if tt.err != "" {
+			if assert.Error(t, err, tt.name) {
+				assert.Contains(t, err.Error(), tt.err, tt.name)
+				assert.NotContains(t, err.Error(), "{", "%s: errors shouldn't dump the selector", tt.name)
+			}
+			continue
+		}
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, tt.apiKey, creds.APIKey, tt.name)
+		}
+	}
+}
+
+func TestCredentialNamespaces(t *testing.T) {
+	defer func(ns string, allowed stringList) {
+		clusterResourceNamespace, allowedSecretNamespaces = ns, allowed
+	}(clusterResourceNamespace, allowedSecretNamespaces)
+	clusterResourceNamespace = "cluster-resources"
+	allowedSecretNamespaces.Set("shared, other")
+
+	secret := func(ns, value string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "dynu-credentials", Namespace: ns},
+			Data:       map[string][]byte{"apikey": []byte(value)},
+		}
+	}
+	solver := &dynuProviderSolver{client: fake.NewSimpleClientset(
+		secret("cluster-resources", "cluster-key"),
+		secret("issuers", "issuer-key"),
+		secret("shared", "shared-key"),
+		secret("private", "private-key"),
+	)}
+	ref := func(ns string) *dynuProviderConfig {
+		sel := secretRef("dynu-credentials", "apikey")
+		sel.Namespace = ns
+		return &dynuProviderConfig{APIKeySecretKeyRef: sel}
+	}
+	withBaseURL := func(cfg *dynuProviderConfig, baseURL string) *dynuProviderConfig {
+		cfg.APIBaseURL = baseURL
+		return cfg
+	}
+
+	tests := []struct {
+		name     string
+		resource string
+		config   *dynuProviderConfig
+		apiKey   string
+		err      string
+	}{
+		{name: "Issuer", resource: "issuers", config: ref(""), apiKey: "issuer-key"},
+		{name: "ClusterIssuer", resource: "cluster-resources", config: ref(""), apiKey: "cluster-key"},
+		{name: "no resource namespace", resource: "", config: ref(""), apiKey: "cluster-key"},
+		{name: "allowed namespace without a resource namespace", resource: "", config: ref("shared"), apiKey: "shared-key"},
+		{name: "own namespace named explicitly", resource: "issuers", config: ref("issuers"), apiKey: "issuer-key"},
+		{name: "allowed namespace", resource: "issuers", config: ref("shared"), apiKey: "shared-key"},
+		{name: "allowed namespace from ClusterIssuer", resource: "cluster-resources", config: ref("shared"), apiKey: "shared-key"},
+		{name: "namespace not allowed", resource: "issuers", config: ref("private"), err: "--allowed-secret-namespaces"},
+		{name: "own namespace with another API", resource: "issuers", config: withBaseURL(ref(""), "https://dynu.example/v2"), apiKey: "issuer-key"},
+		{name: "allowed namespace with the default API", resource: "issuers", config: withBaseURL(ref("shared"), dynuclient.DefaultBaseURL+"/"), apiKey: "shared-key"},
+		{
+			name:     "allowed namespace with another API",
+			resource: "issuers",
+			config:   withBaseURL(ref("shared"), "https://attacker.example/v2"),
+			err:      "may only be used with the default apiBaseURL",
+		},
+		{
+			name:     "allowed namespace with another API from ClusterIssuer",
+			resource: "cluster-resources",
+			config:   withBaseURL(ref("shared"), "https://dynu.example/v2"),
+			err:      "may only be used with the default apiBaseURL",
+		},
+	}
+	for _, tt := range tests {
+		ch := &v1alpha1.ChallengeRequest{ResourceNamespace: tt.resource}
+		creds, err := solver.getCredentials(tt.config, resourceNamespace(ch))
+		if tt.err != "" {
+			if assert.Error(t, err, tt.name) {
+				assert.Contains(t, err.Error(), tt.err, tt.name)
+			}
+			continue
+		}
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, tt.apiKey, creds.APIKey, tt.name)
+		}
+	}
+
+	// without a fallback there is no namespace to read from
+	clusterResourceNamespace = ""
+	_, err := solver.getCredentials(ref(""), resourceNamespace(&v1alpha1.ChallengeRequest{}))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no resource namespace")
+	}
+
+	cfg, err := loadConfig(&extapi.JSON{Raw: []byte(`{"apikeySecretKeyRef": {"name": "dynu-credentials", "key": "apikey", "namespace": "shared"}}`)})
+	assert.NoError(t, err)
+	assert.Equal(t, "shared", cfg.APIKeySecretKeyRef.Namespace)
+	assert.Equal(t, "dynu-credentials", cfg.APIKeySecretKeyRef.Name)
+	assert.Equal(t, "apikey", cfg.APIKeySecretKeyRef.Key)
+}
@@ -10,10 +10,16 @@ groupName: gunstore.github.com
 
 deployment:
   loglevel: 6
+  # Mask Dynu API keys, OAuth2 tokens and challenge keys in the logs. Only
+  # turn this off to debug against a test account.
+  redactLogs: true
 
 certManager:
   namespace: cert-manager
   serviceAccountName: cert-manager
+  # Must match cert-manager's --cluster-resource-namespace. Credentials of
+  # ClusterIssuers are read from here, so the webhook may read Secrets in it.
+  clusterResourceNamespace: cert-manager
 
 image:
   repository: {IMAGE_NAME}
@@ -22,6 +28,63 @@ image:
 
 credentialsSecretRef: dynu-credentials
 
+# Namespaces secret selectors may point to with an explicit `namespace`, e.g.
+# to share one Dynu credentials Secret between Issuers. The webhook may read
+# Secrets in each of them.
+allowedSecretNamespaces: []
+
+# Persist the Dynu record IDs created for each challenge in a ConfigMap in the
+# release namespace, so CleanUp can delete them by ID after a restart. Leave
+# empty to keep them in memory only.
+challengeState:
+  configMapName: ""
+
+# Watch the Secrets in these namespaces instead of fetching credentials for
+# every challenge, e.g. the namespaces of your Issuers and
+# certManager.clusterResourceNamespace for ClusterIssuers. The cache holds
+# every Secret in them, so only list namespaces credentials are kept in.
+# Grants get, list and watch on Secrets in each; set enabled to false to turn
+# the cache off.
+secretCache:
+  enabled: true
+  namespaces: []
+
+# Serve Prometheus metrics about Dynu API calls and challenges on this port,
+# exposed as the "metrics" port of the service.
+metrics:
+  enabled: true
+  port: 9402
+
+# Export OpenTelemetry traces of Present/CleanUp and the Dynu API calls they
+# make to this OTLP/HTTP endpoint, e.g. http://otel-collector:4318. Tracing is
+# off when it's empty. Spans are sent as JSON (http/json); the endpoint must
+# accept that encoding, as the OpenTelemetry Collector's HTTP receiver does.
+tracing:
+  otlpEndpoint: ""
+
+# Record Events such as "TXT record created in Dynu domain example.com" on
+# the Challenges being solved, shown by `kubectl describe challenge`. Needs
+# list and watch on challenges and create on events in all namespaces.
+events:
+  enabled: true
+
+# The HTTP client the webhook reaches the Dynu API with.
+dynuHTTP:
+  timeout: 30s
+  maxIdleConns: 10
+  # How long an idle connection is kept open
+  idleConnTimeout: 90s
+  # 0 means no limit
+  maxConnsPerHost: 0
+  # Egress proxy for the webhook, e.g. http://proxy.example.com:3128. The
+  # webhook reaches the Kubernetes API through it too unless noProxy covers
+  # the API server, e.g. with the service CIDR.
+  httpsProxy: ""
+  noProxy: ""
+  # Name of a ConfigMap in the release namespace whose ca.crt holds extra CAs
+  # to trust for the Dynu API, e.g. of a TLS-inspecting proxy.
+  caConfigMap: ""
+
 nameOverride: ""
 fullnameOverride: ""
 
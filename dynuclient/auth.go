@@ -0,0 +1,268 @@
+package dynuclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator adds credentials to Dynu API requests
+type Authenticator interface {
+	// Authenticate sets the credentials on req
+	Authenticate(ctx context.Context, req *http.Request) error
+	// Invalidate drops cached credentials after Dynu rejected them with a
+	// 401 and reports whether the request is worth repeating with fresh ones
+	Invalidate() bool
+	// Fingerprint identifies the account without revealing its secrets
+	Fingerprint() string
+}
+
+// APIKeyAuth authenticates with a static Dynu API key
+type APIKeyAuth struct {
+	APIKey string
+}
+
+// Authenticate implements Authenticator
+func (a APIKeyAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	req.Header["API-Key"] = []string{a.APIKey}
+	return nil
+}
+
+// Invalidate implements Authenticator. A rejected API key stays rejected.
+func (a APIKeyAuth) Invalidate() bool { return false }
+
+// Fingerprint implements Authenticator
+func (a APIKeyAuth) Fingerprint() string { return fingerprint("api-key", a.APIKey) }
+
+// tokenEndpoint labels token requests in metrics
+const tokenEndpoint = "/oauth2/token"
+
+// TokenURL returns the OAuth2 token endpoint of the API at baseURL, or of
+// DefaultBaseURL when it's empty
+func TokenURL(baseURL string) string {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return strings.TrimSuffix(baseURL, "/") + tokenEndpoint
+}
+
+// tokenExpiryMargin is how long before it expires a token is replaced, so it
+// doesn't run out in flight
+const tokenExpiryMargin = time.Minute
+
+// OAuth2Auth authenticates with short-lived bearer tokens obtained from
+// Dynu's OAuth2 client credentials flow. Tokens are cached until shortly
+// before they expire. It is safe for concurrent use: concurrent requests
+// needing a new token share a single fetch.
+type OAuth2Auth struct {
+	ClientID     string
+	ClientSecret string
+	// TokenURL is the token endpoint; see TokenURL
+	TokenURL string
+	// HTTPClient fetches tokens; nil means the HTTPClient of the DynuClient
+	// asking for a token, or the default client, see SetDefaultHTTPClient
+	HTTPClient *http.Client
+
+	lock    sync.Mutex
+	token   string
+	expires time.Time
+	fetch   *tokenFetch
+	now     func() time.Time
+}
+
+// tokenFetch is a token request in flight; done is closed once token and
+// err are set
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// tokenResponse is the body of a successful token request
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Authenticate implements Authenticator
+func (a *OAuth2Auth) Authenticate(ctx context.Context, req *http.Request) error {
+	token, err := a.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header["Authorization"] = []string{"Bearer " + token}
+	return nil
+}
+
+// Invalidate implements Authenticator. The cached token is dropped so the
+// next request fetches a new one.
+func (a *OAuth2Auth) Invalidate() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.token = ""
+	return true
+}
+
+// Fingerprint implements Authenticator
+func (a *OAuth2Auth) Fingerprint() string {
+	return fingerprint("oauth2", a.TokenURL, a.ClientID, a.ClientSecret)
+}
+
+func (a *OAuth2Auth) clock() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+	return time.Now()
+}
+
+// Token returns a valid access token, fetching a new one if the cached token
+// is missing or about to expire. The lock isn't held while fetching; callers
+// arriving meanwhile wait for the same fetch. When Token is called by a
+// DynuClient, the token request goes through that client's rate limiter and
+// retry policy like any other Dynu API request; otherwise it uses the
+// default ones.
+func (a *OAuth2Auth) Token(ctx context.Context) (string, error) {
+	a.lock.Lock()
+	if a.token != "" && a.clock().Before(a.expires) {
+		token := a.token
+		a.lock.Unlock()
+		return token, nil
+	}
+	if fetch := a.fetch; fetch != nil {
+		a.lock.Unlock()
+		select {
+		case <-fetch.done:
+			return fetch.token, fetch.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	fetch := &tokenFetch{done: make(chan struct{})}
+	a.fetch = fetch
+	a.lock.Unlock()
+
+	var lifetime time.Duration
+	fetch.token, lifetime, fetch.err = a.fetchToken(ctx)
+
+	a.lock.Lock()
+	a.fetch = nil
+	if fetch.err == nil {
+		a.token = fetch.token
+		a.expires = a.clock().Add(lifetime)
+	}
+	a.lock.Unlock()
+	close(fetch.done)
+	return fetch.token, fetch.err
+}
+
+// fetchToken requests a new token and returns it with how long it may be
+// used for
+func (a *OAuth2Auth) fetchToken(ctx context.Context) (string, time.Duration, error) {
+	tokenURL := a.TokenURL
+	if tokenURL == "" {
+		tokenURL = TokenURL("")
+	}
+	client := &DynuClient{
+		BaseURL:    strings.TrimSuffix(tokenURL, tokenEndpoint),
+		HTTPClient: a.HTTPClient,
+		Auth:       basicAuth{username: a.ClientID, password: a.ClientSecret},
+	}
+	if c, ok := ctx.Value(clientKey{}).(*DynuClient); ok {
+		client.RateLimiter = c.limiter()
+		client.RetryPolicy = c.RetryPolicy
+		client.UserAgent = c.UserAgent
+		client.Log = c.Log
+		client.OnEvent = c.OnEvent
+		if client.HTTPClient == nil {
+			client.HTTPClient = c.HTTPClient
+		}
+	}
+	resp, err := client.makeRequest(ctx, tokenURL, "GET", nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("requesting Dynu OAuth2 token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, readAPIError(resp, nil)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", 0, fmt.Errorf("decoding Dynu OAuth2 token: %v", err)
+	}
+	if token.AccessToken == "" {
+		return "", 0, newAPIError("GET", tokenURL, http.StatusOK, body, nil)
+	}
+	lifetime := time.Duration(token.ExpiresIn)*time.Second - tokenExpiryMargin
+	if lifetime < 0 {
+		lifetime = 0
+	}
+	client.logger().V(DebugLevel).Info("fetched Dynu OAuth2 token", "clientID", a.ClientID, "token", Redacted(token.AccessToken), "expiresIn", token.ExpiresIn)
+	return token.AccessToken, lifetime, nil
+}
+
+// basicAuth authenticates token requests with the OAuth2 client credentials
+type basicAuth struct {
+	username, password string
+}
+
+// Authenticate implements Authenticator
+func (a basicAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+// Invalidate implements Authenticator. Rejected client credentials stay
+// rejected.
+func (a basicAuth) Invalidate() bool { return false }
+
+// Fingerprint implements Authenticator
+func (a basicAuth) Fingerprint() string { return fingerprint("basic", a.username, a.password) }
+
+// clientKey carries the DynuClient sending a request to its Authenticator
+type clientKey struct{}
+
+var (
+	oauth2Mu    sync.Mutex
+	oauth2Auths = map[string]*OAuth2Auth{}
+)
+
+// SharedOAuth2Auth returns the process-wide OAuth2Auth of issuer, so every
+// DynuClient of the issuer shares one cached token. issuer identifies where
+// the credentials come from; when they change, e.g. because a Secret was
+// rotated, the issuer's OAuth2Auth is replaced rather than kept alongside.
+func SharedOAuth2Auth(issuer, tokenURL, clientID, clientSecret string) *OAuth2Auth {
+	oauth2Mu.Lock()
+	defer oauth2Mu.Unlock()
+	a, ok := oauth2Auths[issuer]
+	if !ok || a.Fingerprint() != fingerprint("oauth2", tokenURL, clientID, clientSecret) {
+		a = &OAuth2Auth{ClientID: clientID, ClientSecret: clientSecret, TokenURL: tokenURL}
+		oauth2Auths[issuer] = a
+	}
+	return a
+}
+
+// authenticator returns the credentials this client sends
+func (c *DynuClient) authenticator() Authenticator {
+	if c.Auth != nil {
+		return c.Auth
+	}
+	return APIKeyAuth{APIKey: c.APIKey}
+}
+
+// fingerprint hashes parts so secrets can be compared without being kept
+func fingerprint(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
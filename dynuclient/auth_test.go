@@ -0,0 +1,171 @@
+package dynuclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
+	"github.com/stretchr/testify/assert"
+)
+
+func tokenRequests(api *dynutest.Server) int {
+	n := 0
+	for _, r := range api.Requests() {
+		if strings.HasSuffix(r, "/oauth2/token") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestOAuth2Auth(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+	api.ClientID, api.ClientSecret = "client-id", "client-secret"
+	dynu := newRetryTestClient(api.URL)
+	dynu.Auth = &OAuth2Auth{ClientID: "client-id", ClientSecret: "client-secret", TokenURL: TokenURL(api.URL)}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := dynu.ListDomains(ctx)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, tokenRequests(api), "the token should be cached")
+
+	api.ExpireTokens()
+	_, err := dynu.ListDomains(ctx)
+	assert.NoError(t, err, "a rejected token should be refreshed and the request repeated")
+	assert.Equal(t, 2, tokenRequests(api))
+
+	dynu.Auth = &OAuth2Auth{ClientID: "client-id", ClientSecret: "wrong", TokenURL: TokenURL(api.URL)}
+	before := len(api.Requests())
+	_, err = dynu.ListDomains(ctx)
+	assert.True(t, errors.Is(err, ErrUnauthorized), "got %v", err)
+	assert.Len(t, api.Requests()[before:], 1, "bad client credentials shouldn't be retried")
+}
+
+// unlimitedTokens is a context for calling Token as an unlimited client
+// would, rather than waiting on the default rate limit
+var unlimitedTokens = context.WithValue(context.Background(), clientKey{}, &DynuClient{RateLimiter: unlimited})
+
+func TestOAuth2TokenExpiry(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+	api.ClientID, api.ClientSecret = "client-id", "client-secret"
+	api.TokenTTL = 2 * time.Hour
+
+	now := time.Now()
+	auth := &OAuth2Auth{ClientID: "client-id", ClientSecret: "client-secret", TokenURL: TokenURL(api.URL), now: func() time.Time { return now }}
+	first, err := auth.Token(unlimitedTokens)
+	assert.NoError(t, err)
+	now = now.Add(2*time.Hour - 2*tokenExpiryMargin)
+	second, _ := auth.Token(unlimitedTokens)
+	assert.Equal(t, first, second)
+	now = now.Add(tokenExpiryMargin)
+	third, _ := auth.Token(unlimitedTokens)
+	assert.NotEqual(t, first, third, "tokens should be replaced before they expire")
+}
+
+func TestOAuth2TokenFetchIsShared(t *testing.T) {
+	release := make(chan struct{})
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		fmt.Fprint(w, `{"access_token": "token", "token_type": "bearer", "expires_in": 3600}`)
+	}))
+	defer srv.Close()
+	auth := &OAuth2Auth{ClientID: "client-id", ClientSecret: "client-secret", TokenURL: TokenURL(srv.URL)}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 3)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = auth.Token(unlimitedTokens)
+		}(i)
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&fetches) == 1 }, 5*time.Second, time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		auth.Invalidate()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock shouldn't be held while a token is fetched")
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(t, []string{"token", "token", "token"}, tokens)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches), "concurrent callers should share one fetch")
+}
+
+// countingLimiter counts the requests it lets through
+type countingLimiter struct{ waits int32 }
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	atomic.AddInt32(&l.waits, 1)
+	return nil
+}
+
+func TestOAuth2TokenFetchIsRateLimitedAndRetried(t *testing.T) {
+	var tokenRequests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/oauth2/token" {
+			if atomic.AddInt32(&tokenRequests, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"access_token": "token", "token_type": "bearer", "expires_in": 3600}`)
+			return
+		}
+		assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"statusCode": 200, "domains": []}`)
+	}))
+	defer srv.Close()
+	limiter := &countingLimiter{}
+	var events []Event
+	dynu := &DynuClient{BaseURL: srv.URL, RateLimiter: limiter, RetryPolicy: fastRetries, OnEvent: func(ev Event) { events = append(events, ev) },
+		Auth: &OAuth2Auth{ClientID: "client-id", ClientSecret: "client-secret", TokenURL: TokenURL(srv.URL)}}
+
+	_, err := dynu.ListDomains(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&tokenRequests), "a failed token request should be retried")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&limiter.waits), "token requests should draw from the client's rate limiter")
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "/oauth2/token", events[0].Endpoint)
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	auth := APIKeyAuth{APIKey: "key"}
+	assert.NoError(t, auth.Authenticate(context.Background(), req))
+	assert.Equal(t, []string{"key"}, req.Header["API-Key"])
+	assert.False(t, auth.Invalidate())
+	assert.NotContains(t, auth.Fingerprint(), "key")
+	assert.NotEqual(t, auth.Fingerprint(), APIKeyAuth{APIKey: "other"}.Fingerprint())
+
+	shared := SharedOAuth2Auth("issuer", "u", "id", "secret")
+	assert.True(t, shared == SharedOAuth2Auth("issuer", "u", "id", "secret"))
+	assert.False(t, shared == SharedOAuth2Auth("other-issuer", "u", "id", "secret"))
+	rotated := SharedOAuth2Auth("issuer", "u", "id", "rotated")
+	assert.False(t, shared == rotated, "changed credentials should get a new OAuth2Auth")
+	assert.Equal(t, "rotated", rotated.ClientSecret)
+	assert.True(t, rotated == SharedOAuth2Auth("issuer", "u", "id", "rotated"), "the old OAuth2Auth should have been replaced")
+	oauth2Mu.Lock()
+	assert.True(t, oauth2Auths["issuer"] == rotated)
+	oauth2Mu.Unlock()
+	assert.Equal(t, DefaultBaseURL+"/oauth2/token", TokenURL(""))
+}
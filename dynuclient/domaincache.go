@@ -0,0 +1,195 @@
+package dynuclient
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultDomainCacheTTL is how long a hostname's root domain is remembered
+const DefaultDomainCacheTTL = time.Hour
+
+// DefaultNegativeDomainCacheTTL is how long a hostname Dynu has no domain
+// for is remembered
+const DefaultNegativeDomainCacheTTL = time.Minute
+
+// DomainCacheKey identifies a cached root domain lookup
+type DomainCacheKey struct {
+	// Hostname is the name looked up, normalized to lower case without a
+	// trailing dot
+	Hostname string
+	// Account fingerprints the API endpoint and credentials the lookup was
+	// made with, so accounts never see each other's domains
+	Account string
+}
+
+// DomainCache remembers which Dynu domain a hostname belongs to. It must be
+// safe for concurrent use.
+type DomainCache interface {
+	// Get returns the cached domain for key. found is false when nothing is
+	// cached; a nil domain with found set means Dynu has no domain for the
+	// hostname.
+	Get(key DomainCacheKey) (domain *Domain, found bool)
+	// Add caches domain for key, or that there is no domain when it's nil
+	Add(key DomainCacheKey, domain *Domain)
+	// Remove drops the entry for key
+	Remove(key DomainCacheKey)
+	// RemoveDomain drops every entry of account that resolves to domainID,
+	// after Dynu reported the domain missing
+	RemoveDomain(account string, domainID int)
+}
+
+// NewDomainCache returns an in-memory DomainCache keeping domains for ttl and
+// unknown hostnames for negativeTTL. A TTL of zero or less disables that
+// kind of entry.
+func NewDomainCache(ttl, negativeTTL time.Duration) DomainCache {
+	return &memoryDomainCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     map[DomainCacheKey]domainCacheEntry{},
+		now:         time.Now,
+	}
+}
+
+type domainCacheEntry struct {
+	domain  *Domain
+	expires time.Time
+}
+
+type memoryDomainCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	lock    sync.Mutex
+	entries map[DomainCacheKey]domainCacheEntry
+	now     func() time.Time
+}
+
+func (m *memoryDomainCache) Get(key DomainCacheKey) (*Domain, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !m.now().Before(e.expires) {
+		delete(m.entries, key)
+		return nil, false
+	}
+	if e.domain == nil {
+		return nil, true
+	}
+	domain := *e.domain
+	return &domain, true
+}
+
+func (m *memoryDomainCache) Add(key DomainCacheKey, domain *Domain) {
+	ttl := m.ttl
+	if domain == nil {
+		ttl = m.negativeTTL
+	} else {
+		d := *domain
+		domain = &d
+	}
+	if ttl <= 0 {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := m.now()
+	// drop expired entries so hostnames that are never asked about again
+	// don't pile up
+	for k, e := range m.entries {
+		if !now.Before(e.expires) {
+			delete(m.entries, k)
+		}
+	}
+	m.entries[key] = domainCacheEntry{domain: domain, expires: now.Add(ttl)}
+}
+
+func (m *memoryDomainCache) Remove(key DomainCacheKey) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.entries, key)
+}
+
+func (m *memoryDomainCache) RemoveDomain(account string, domainID int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for k, e := range m.entries {
+		if k.Account == account && e.domain != nil && e.domain.ID == domainID {
+			delete(m.entries, k)
+		}
+	}
+}
+
+// noDomainCache is a DomainCache that remembers nothing
+type noDomainCache struct{}
+
+func (noDomainCache) Get(DomainCacheKey) (*Domain, bool) { return nil, false }
+func (noDomainCache) Add(DomainCacheKey, *Domain)        {}
+func (noDomainCache) Remove(DomainCacheKey)              {}
+func (noDomainCache) RemoveDomain(string, int)           {}
+
+// NoDomainCache disables caching when set as DynuClient.DomainCache
+var NoDomainCache DomainCache = noDomainCache{}
+
+var (
+	domainCacheMu      sync.Mutex
+	defaultDomainCache = NewDomainCache(DefaultDomainCacheTTL, DefaultNegativeDomainCacheTTL)
+)
+
+// SetDefaultDomainCache changes the cache used by clients that don't set
+// DynuClient.DomainCache
+func SetDefaultDomainCache(cache DomainCache) {
+	domainCacheMu.Lock()
+	defer domainCacheMu.Unlock()
+	if cache == nil {
+		cache = NoDomainCache
+	}
+	defaultDomainCache = cache
+}
+
+// DefaultDomainCache returns the process-wide domain cache
+func DefaultDomainCache() DomainCache {
+	domainCacheMu.Lock()
+	defer domainCacheMu.Unlock()
+	return defaultDomainCache
+}
+
+// domainCache returns the cache this client uses
+func (c *DynuClient) domainCache() DomainCache {
+	if c.DomainCache != nil {
+		return c.DomainCache
+	}
+	return DefaultDomainCache()
+}
+
+// account fingerprints the endpoint and credentials of the client. Only a
+// hash is kept so caches never hold credentials.
+func (c *DynuClient) account() string {
+	return fingerprint(c.baseURL(), c.authenticator().Fingerprint())
+}
+
+func (c *DynuClient) domainCacheKey(hostname string) DomainCacheKey {
+	name, err := normalizeName(hostname)
+	if err != nil {
+		name = hostname
+	}
+	return DomainCacheKey{Hostname: name, Account: c.account()}
+}
+
+// forgetDomain drops cached lookups resolving to domainID when err says
+// Dynu no longer has it, and returns err
+func (c *DynuClient) forgetDomain(domainID int, err error) error {
+	if errors.Is(err, ErrDomainNotFound) {
+		c.domainCache().RemoveDomain(c.account(), domainID)
+	}
+	return err
+}
+
+// cachedDomainNotFound is returned for hostnames cached as unknown
+func cachedDomainNotFound(hostname string) error {
+	return fmt.Errorf("%w: no Dynu domain for %q (cached)", ErrDomainNotFound, hostname)
+}
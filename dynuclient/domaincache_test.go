@@ -0,0 +1,106 @@
+package dynuclient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomainCacheExpiry(t *testing.T) {
+	now := time.Now()
+	cache := NewDomainCache(time.Hour, time.Minute).(*memoryDomainCache)
+	cache.now = func() time.Time { return now }
+	found := DomainCacheKey{Hostname: "www.example.com", Account: "a"}
+	unknown := DomainCacheKey{Hostname: "example.net", Account: "a"}
+
+	cache.Add(found, &Domain{ID: 1, DomainName: "example.com"})
+	cache.Add(unknown, nil)
+	d, ok := cache.Get(found)
+	assert.True(t, ok)
+	assert.Equal(t, 1, d.ID)
+	d.ID = 2
+	d, _ = cache.Get(found)
+	assert.Equal(t, 1, d.ID, "callers shouldn't be able to change cached domains")
+	d, ok = cache.Get(unknown)
+	assert.True(t, ok)
+	assert.Nil(t, d)
+	_, ok = cache.Get(DomainCacheKey{Hostname: "www.example.com", Account: "b"})
+	assert.False(t, ok, "accounts shouldn't share entries")
+
+	now = now.Add(2 * time.Minute)
+	_, ok = cache.Get(unknown)
+	assert.False(t, ok, "negative entries should expire after the negative TTL")
+	_, ok = cache.Get(found)
+	assert.True(t, ok)
+
+	cache.RemoveDomain("b", 1)
+	_, ok = cache.Get(found)
+	assert.True(t, ok, "RemoveDomain should only affect its account")
+	cache.RemoveDomain("a", 1)
+	_, ok = cache.Get(found)
+	assert.False(t, ok)
+
+	cache.Add(found, &Domain{ID: 1})
+	now = now.Add(time.Hour)
+	_, ok = cache.Get(found)
+	assert.False(t, ok, "entries should expire after the TTL")
+
+	off := NewDomainCache(0, 0)
+	off.Add(found, &Domain{ID: 1})
+	off.Add(unknown, nil)
+	_, ok = off.Get(found)
+	assert.False(t, ok)
+	_, ok = off.Get(unknown)
+	assert.False(t, ok)
+}
+
+func getrootRequests(api *dynutest.Server) int {
+	n := 0
+	for _, r := range api.Requests() {
+		if strings.HasPrefix(r, "GET /v2/dns/getroot/") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDomainCacheLookups(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+	dynu := newRetryTestClient(api.URL)
+	dynu.APIKey = api.APIKey
+	dynu.DomainCache = NewDomainCache(time.Hour, time.Hour)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		zone, err := dynu.ResolveZone(ctx, "_acme-challenge.WWW.example.com.")
+		if assert.NoError(t, err) {
+			assert.Equal(t, 1001, zone.DomainID)
+		}
+		_, err = dynu.ResolveZone(ctx, "_acme-challenge.example.net.")
+		assert.True(t, errors.Is(err, ErrDomainNotFound), "got %v", err)
+	}
+	assert.Equal(t, 2, getrootRequests(api), "lookups should be cached, including unknown domains")
+
+	other := *dynu
+	other.APIKey = "other-key"
+	_, err := other.ResolveZone(ctx, "_acme-challenge.www.example.com.")
+	assert.True(t, errors.Is(err, ErrUnauthorized), "another API key shouldn't see cached domains, got %v", err)
+	assert.Equal(t, 3, getrootRequests(api))
+
+	// the domain is deleted and re-added under a new ID
+	api.RemoveDomain(1001)
+	newID := api.AddDomain("example.com")
+	_, err = dynu.ListRecords(ctx, 1001)
+	assert.True(t, errors.Is(err, ErrDomainNotFound), "got %v", err)
+	zone, err := dynu.ResolveZone(ctx, "_acme-challenge.www.example.com.")
+	if assert.NoError(t, err) {
+		assert.Equal(t, newID, zone.DomainID, "a domain Dynu reported missing should be looked up again")
+	}
+	assert.Equal(t, 4, getrootRequests(api))
+}
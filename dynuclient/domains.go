@@ -0,0 +1,110 @@
+package dynuclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ListDomains returns every domain in the Dynu account
+//   GET https://api.dynu.com/v2/dns
+func (c *DynuClient) ListDomains(ctx context.Context) (_ []Domain, err error) {
+	ctx, span := startSpan(ctx, "ListDomains")
+	defer func() { endSpan(span, err) }()
+	dnsURL := fmt.Sprintf("%s/dns", c.baseURL())
+	resp, err := c.makeRequest(ctx, dnsURL, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	var domains Domains
+	if err := decodeResponse(resp, nil, &domains); err != nil {
+		return nil, err
+	}
+	for i := range domains.Domains {
+		domains.Domains[i].fillDomainName()
+	}
+	return domains.Domains, nil
+}
+
+// GetDomain returns a domain by ID, or an error matching ErrDomainNotFound
+// if the account has no such domain
+//   GET https://api.dynu.com/v2/dns/{DNSID}
+func (c *DynuClient) GetDomain(ctx context.Context, domainID int) (_ *Domain, err error) {
+	ctx, span := startSpan(ctx, "GetDomain", AttrDomainID.Int(domainID))
+	defer func() { endSpan(span, err) }()
+	dnsURL := fmt.Sprintf("%s/dns/%d", c.baseURL(), domainID)
+	resp, err := c.makeRequest(ctx, dnsURL, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	var domain Domain
+	if err := decodeResponse(resp, ErrDomainNotFound, &domain); err != nil {
+		return nil, c.forgetDomain(domainID, err)
+	}
+	domain.fillDomainName()
+	return &domain, nil
+}
+
+// domainUpdate is the body of a domain update. Dynu replaces every setting,
+// so all of them are sent.
+type domainUpdate struct {
+	Name              string `json:"name"`
+	Group             string `json:"group,omitempty"`
+	IPv4Address       string `json:"ipv4Address,omitempty"`
+	IPv6Address       string `json:"ipv6Address,omitempty"`
+	TTL               int    `json:"ttl,omitempty"`
+	IPv4              bool   `json:"ipv4"`
+	IPv6              bool   `json:"ipv6"`
+	IPv4WildcardAlias bool   `json:"ipv4WildcardAlias"`
+	IPv6WildcardAlias bool   `json:"ipv6WildcardAlias"`
+	AllowZoneTransfer bool   `json:"allowZoneTransfer"`
+	DNSSEC            bool   `json:"dnssec"`
+}
+
+// UpdateDomain saves the settings of domain, which is typically a Domain
+// returned by GetDomain with some fields changed. Fields Dynu manages itself,
+// such as NameServers and UpdatedOn, are ignored.
+//   POST https://api.dynu.com/v2/dns/{DNSID}
+func (c *DynuClient) UpdateDomain(ctx context.Context, domain Domain) (err error) {
+	ctx, span := startSpan(ctx, "UpdateDomain", AttrDomainID.Int(domain.ID))
+	defer func() { endSpan(span, err) }()
+	if domain.ID == 0 {
+		return fmt.Errorf("can't update a domain without an ID")
+	}
+	name := domain.Name
+	if name == "" {
+		name = domain.DomainName
+	}
+	body, err := json.Marshal(domainUpdate{
+		Name:              name,
+		Group:             domain.Group,
+		IPv4Address:       domain.IPv4Address,
+		IPv6Address:       domain.IPv6Address,
+		TTL:               domain.TTL,
+		IPv4:              domain.IPv4,
+		IPv6:              domain.IPv6,
+		IPv4WildcardAlias: domain.IPv4WildcardAlias,
+		IPv6WildcardAlias: domain.IPv6WildcardAlias,
+		AllowZoneTransfer: domain.AllowZoneTransfer,
+		DNSSEC:            domain.DNSSEC,
+	})
+	if err != nil {
+		return err
+	}
+	dnsURL := fmt.Sprintf("%s/dns/%d", c.baseURL(), domain.ID)
+
+	// an update overwrites every setting, so sending it again is harmless
+	resp, err := c.withRetry(ctx, "POST", dnsURL, body, func(context.Context) bool { return false })
+	if err != nil {
+		return err
+	}
+	return c.forgetDomain(domain.ID, decodeResponse(resp, ErrDomainNotFound, nil))
+}
+
+// fillDomainName sets DomainName from Name, which is what /dns and /dns/{id}
+// call it
+func (d *Domain) fillDomainName() {
+	if d.DomainName == "" {
+		d.DomainName = d.Name
+	}
+}
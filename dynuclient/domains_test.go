@@ -0,0 +1,58 @@
+package dynuclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomains(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com", "example.org")
+	defer api.Close()
+	dynu := newRetryTestClient(api.URL)
+	dynu.APIKey = api.APIKey
+	ctx := context.Background()
+
+	domains, err := dynu.ListDomains(ctx)
+	if assert.NoError(t, err) && assert.Len(t, domains, 2) {
+		assert.Equal(t, 1001, domains[0].ID)
+		assert.Equal(t, "example.com", domains[0].Name)
+		assert.Equal(t, "example.com", domains[0].DomainName)
+		assert.Equal(t, "example.org", domains[1].DomainName)
+		assert.Equal(t, 300, domains[1].TTL)
+	}
+
+	domain, err := dynu.GetDomain(ctx, 1002)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "example.org", domain.DomainName)
+	assert.Equal(t, dynutest.NameServers, domain.NameServers)
+	assert.NotEmpty(t, domain.UpdatedOn)
+	assert.False(t, domain.DNSSEC)
+
+	domain.TTL = 120
+	domain.IPv4Address = "192.0.2.1"
+	domain.DNSSEC = true
+	assert.NoError(t, dynu.UpdateDomain(ctx, *domain))
+	updated, err := dynu.GetDomain(ctx, 1002)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 120, updated.TTL)
+		assert.Equal(t, "192.0.2.1", updated.IPv4Address)
+		assert.True(t, updated.IPv4)
+		assert.True(t, updated.DNSSEC)
+	}
+
+	_, err = dynu.GetDomain(ctx, 999)
+	assert.True(t, errors.Is(err, ErrDomainNotFound), "got %v", err)
+	err = dynu.UpdateDomain(ctx, Domain{ID: 999, Name: "example.net"})
+	assert.True(t, errors.Is(err, ErrDomainNotFound), "got %v", err)
+	assert.Error(t, dynu.UpdateDomain(ctx, Domain{Name: "example.com"}), "updating a domain without an ID")
+
+	dynu.APIKey = "wrong"
+	_, err = dynu.ListDomains(ctx)
+	assert.True(t, errors.Is(err, ErrUnauthorized), "got %v", err)
+}
@@ -2,50 +2,81 @@ package dynuclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"runtime"
+	"net/url"
 	"strings"
 	"time"
-
-	"k8s.io/klog"
 )
 
-const dynuAPI string = "https://api.dynu.com/v2"
-
-// Control how quickly the dynu API is queried.  There may be a rate limit
-const dynuRateLimit int = 5
-
-var httpClient *http.Client
+// DefaultBaseURL is the Dynu API used when DynuClient.BaseURL is empty
+const DefaultBaseURL string = "https://api.dynu.com/v2"
 
 // CreateDNSRecord ... Create a DNS Record and return it's ID
 //   POST https://api.dynu.com/v2/dns/{DNSID}/record
 func (c *DynuClient) CreateDNSRecord(record DNSRecord) (int, error) {
-	klog.Info("\n\nCreating DNS Record for: ", record.NodeName, " hostname: ", c.HostName, " textdata: ", record.TextData, "\n\n")
-	domainID, err := c.GetDomainID()
-	if err != nil {
-		klog.Error(fmt.Sprintf("\n\nCreateDNSRecord...Err: %v\n", err))
-		return -1, err
+	return c.CreateDNSRecordWithContext(context.Background(), record)
+}
+
+// CreateDNSRecordWithContext is CreateDNSRecord with a context that can
+// cancel the API calls it makes. If record.DomainID is set it is used instead
+// of looking up the domain of c.HostName, and record.DomainName lets the
+// check for an existing record skip listing the whole domain.
+func (c *DynuClient) CreateDNSRecordWithContext(ctx context.Context, record DNSRecord) (id int, err error) {
+	ctx, span := startSpan(ctx, "CreateDNSRecord", AttrHostname.String(c.HostName), AttrNodeName.String(record.NodeName))
+	defer func() {
+		if err == nil {
+			span.SetAttributes(AttrRecordID.Int(id))
+		}
+		endSpan(span, err)
+	}()
+	log := c.logger().WithValues("hostname", c.HostName, "node", record.NodeName)
+	log.V(DebugLevel).Info("creating TXT record", "value", Redacted(record.TextData))
+	domainID := record.DomainID
+	if domainID == 0 {
+		domainID, err = c.GetDomainIDWithContext(ctx)
+		if err != nil {
+			return -1, err
+		}
 	}
-	dnsRecord, err := c.GetDNSRecord(domainID, record.NodeName, record.TextData)
+	span.SetAttributes(AttrDomainID.Int(domainID))
+	log = log.WithValues("domainID", domainID)
+	dnsRecord, err := c.findTXTRecord(ctx, domainID, record.DomainName, record.NodeName, record.TextData)
 	if err == nil {
+		log.V(ExtendedInfoLevel).Info("TXT record already exists", "recordID", dnsRecord.ID)
+		c.emit(Event{Kind: EventRecordExists, DomainID: domainID, DomainName: record.DomainName, RecordID: dnsRecord.ID})
 		return dnsRecord.ID, nil
 	}
-	dnsURL := fmt.Sprintf("%s/dns/%d/record", dynuAPI, domainID)
+	dnsURL := fmt.Sprintf("%s/dns/%d/record", c.baseURL(), domainID)
 	body, err := json.Marshal(record)
 	if err != nil {
-		klog.Error(fmt.Sprintf("\n\nCreateDNSRecord...Err: %v\n", err))
 		return -1, err
 	}
 
 	var resp *http.Response
 
-	resp, err = c.makeRequest(dnsURL, "POST", bytes.NewReader(body))
+	// POST isn't idempotent, so only retry it once we know the previous
+	// attempt didn't create the record after all
+	existingID := -1
+	resp, err = c.withRetry(ctx, "POST", dnsURL, body, func(ctx context.Context) bool {
+		dnsRecord, err := c.findTXTRecord(ctx, domainID, record.DomainName, record.NodeName, record.TextData)
+		if err != nil {
+			return false
+		}
+		existingID = dnsRecord.ID
+		return true
+	})
+	if errors.Is(err, errAlreadyApplied) {
+		log.V(ExtendedInfoLevel).Info("TXT record was created by an earlier attempt", "recordID", existingID)
+		c.emit(Event{Kind: EventRecordCreated, DomainID: domainID, DomainName: record.DomainName, RecordID: existingID})
+		return existingID, nil
+	}
 	if err != nil {
-		klog.Error(fmt.Sprintf("\n\nCreateDNSRecord...Err: %v\n", err))
 		return -1, err
 	}
 
@@ -53,68 +84,138 @@ func (c *DynuClient) CreateDNSRecord(record DNSRecord) (int, error) {
 	if resp.StatusCode == http.StatusOK {
 		bodyBytes, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			klog.Error(fmt.Sprintf("\n\nCreateDNSRecord...Err: %v\n", err))
 			return -1, err
 		}
-		c.logResponseBody(bodyBytes)
+		log.V(TraceLevel).Info("Dynu response", "body", responseBody(bodyBytes))
 		var dnsBody DNSResponse
 		err = json.Unmarshal(bodyBytes, &dnsBody)
 		if err != nil {
-			klog.Error(fmt.Sprintf("\n\nCreateDNSRecord...Err: %v\n", err))
 			return -1, err
 		}
-		klog.Info("\n\nDNS Record created for: ", record.NodeName, " hostname: ", c.HostName, "\n\n")
+		if dnsBody.StatusCode != 0 && dnsBody.StatusCode != http.StatusOK {
+			return -1, c.forgetDomain(domainID, newAPIError("POST", dnsURL, http.StatusOK, bodyBytes, ErrDomainNotFound))
+		}
+		log.V(InfoLevel).Info("created TXT record", "recordID", dnsBody.ID)
+		c.emit(Event{Kind: EventRecordCreated, DomainID: domainID, DomainName: record.DomainName, RecordID: dnsBody.ID})
 		return dnsBody.ID, nil
 	}
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		klog.Error(fmt.Sprintf("\n\nCreateDNSRecord...Err: %v\n", err))
-		return -1, err
-	}
-
-	c.logResponseBody(bodyBytes)
-
-	return -1, fmt.Errorf("%s received for %s", resp.Status, dnsURL)
+	return -1, c.forgetDomain(domainID, readAPIError(resp, ErrDomainNotFound))
 }
 
 // RemoveDNSRecord ... Removes a DNS record based on dnsRecordID
 //   DELETE https://api.dynu.com/v2/dns/{DNSID}/record/{DNSRecordID}
 func (c *DynuClient) RemoveDNSRecord(nodeName, textData string) error {
-	klog.Info("\n\nRemoving DNS Record for: ", nodeName, " hostname: ", c.HostName, " with text: ", textData, "\n\n")
-	var err error
-	domainID, err := c.GetDomainID()
+	return c.RemoveDNSRecordWithContext(context.Background(), nodeName, textData)
+}
+
+// RemoveDNSRecordWithContext is RemoveDNSRecord with a context that can
+// cancel the API calls it makes
+func (c *DynuClient) RemoveDNSRecordWithContext(ctx context.Context, nodeName, textData string) (err error) {
+	ctx, span := startSpan(ctx, "RemoveDNSRecord", AttrHostname.String(c.HostName), AttrNodeName.String(nodeName))
+	defer func() { endSpan(span, err) }()
+	log := c.logger().WithValues("hostname", c.HostName, "node", nodeName)
+	log.V(DebugLevel).Info("removing TXT record", "value", Redacted(textData))
+	domainID, err := c.GetDomainIDWithContext(ctx)
 	if err != nil {
 		return err
 	}
-	klog.Info(fmt.Sprintf("\n\nRemoveDNSRecord: \nDomainId: %d\n\n", domainID))
-	dnsRecord, err := c.GetDNSRecord(domainID, nodeName, textData)
+	log = log.WithValues("domainID", domainID)
+	dnsRecord, err := c.GetDNSRecordWithContext(ctx, domainID, nodeName, textData)
 	if err != nil {
-		if strings.Contains(err.Error(), "Unable to find DNS Records") {
-			klog.Info(fmt.Sprintf("Couldn't find record: %v", err))
+		if errors.Is(err, ErrRecordNotFound) {
+			log.V(ExtendedInfoLevel).Info("TXT record is already gone")
+			c.emit(Event{Kind: EventRecordGone, DomainID: domainID})
 			return nil
 		}
 		return err
 	}
 
-	dnsURL := fmt.Sprintf("%s/dns/%d/record/%d", dynuAPI, domainID, dnsRecord.ID)
-	var resp *http.Response
-
-	resp, err = c.makeRequest(dnsURL, "DELETE", nil)
+	err = c.DeleteDNSRecordWithContext(ctx, domainID, dnsRecord.ID)
 	if err != nil {
+		return err
+	}
+	log.V(InfoLevel).Info("removed TXT record", "recordID", dnsRecord.ID)
+	return nil
+}
+
+// DeleteDNSRecordWithContext removes a DNS record by ID. A record that is
+// already gone is not an error.
+//   DELETE https://api.dynu.com/v2/dns/{DNSID}/record/{DNSRecordID}
+func (c *DynuClient) DeleteDNSRecordWithContext(ctx context.Context, domainID, recordID int) (err error) {
+	ctx, span := startSpan(ctx, "DeleteDNSRecord", AttrDomainID.Int(domainID), AttrRecordID.Int(recordID))
+	defer func() { endSpan(span, err) }()
+	err = c.DeleteRecord(ctx, domainID, recordID)
+	if errors.Is(err, ErrRecordNotFound) {
+		c.logger().V(ExtendedInfoLevel).Info("record is already gone", "domainID", domainID, "recordID", recordID)
+		c.emit(Event{Kind: EventRecordGone, DomainID: domainID, RecordID: recordID})
 		return nil
 	}
+	if err == nil {
+		c.emit(Event{Kind: EventRecordDeleted, DomainID: domainID, RecordID: recordID})
+	}
+	return err
+}
 
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf(resp.Status)
+// ValidateBaseURL checks that baseURL can be used as DynuClient.BaseURL
+func ValidateBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid Dynu API base URL %q: %v", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid Dynu API base URL %q: scheme must be http or https", baseURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid Dynu API base URL %q: missing host", baseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("invalid Dynu API base URL %q: query and fragment are not allowed", baseURL)
 	}
-	klog.Info("\n\nDNS Record removed for: ", nodeName, " hostname: ", c.HostName, " with text: ", textData, "\n\n")
 	return nil
 }
 
-func (c *DynuClient) makeRequest(URL string, method string, body io.Reader) (*http.Response, error) {
-	time.Sleep(time.Duration(dynuRateLimit) * time.Second)
-	req, err := http.NewRequest(method, URL, body)
+// baseURL returns the API root requests are built from, without a trailing slash
+func (c *DynuClient) baseURL() string {
+	if c.BaseURL == "" {
+		return DefaultBaseURL
+	}
+	return strings.TrimSuffix(c.BaseURL, "/")
+}
+
+// makeRequest sends a request, retrying idempotent methods according to the
+// client's RetryPolicy
+func (c *DynuClient) makeRequest(ctx context.Context, URL string, method string, body []byte) (*http.Response, error) {
+	return c.withRetry(ctx, method, URL, body, nil)
+}
+
+// send makes a single rate-limited attempt at a request. A request Dynu
+// rejects with a 401 is repeated once if the authenticator can refresh its
+// credentials.
+func (c *DynuClient) send(ctx context.Context, method, URL string, body []byte) (*http.Response, error) {
+	resp, err := c.sendOnce(ctx, method, URL, body)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && c.authenticator().Invalidate() {
+		resp.Body.Close()
+		c.logger().V(InfoLevel).Info("Dynu rejected the credentials, retrying with fresh ones", "method", method, "endpoint", c.endpoint(URL))
+		resp, err = c.sendOnce(ctx, method, URL, body)
+	}
+	return resp, err
+}
+
+func (c *DynuClient) sendOnce(ctx context.Context, method, URL string, body []byte) (*http.Response, error) {
+	waitStart := time.Now()
+	if err := c.limiter().Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	rateLimiterWait.Observe(time.Since(waitStart).Seconds())
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	endpoint := c.endpoint(URL)
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, endpointKey{}, endpoint), method, URL, reqBody)
 	if err != nil {
 		return nil, err
 	}
@@ -122,103 +223,103 @@ func (c *DynuClient) makeRequest(URL string, method string, body io.Reader) (*ht
 	req.Header["accept"] = []string{"application/json"}
 	req.Header["User-Agent"] = []string{c.UserAgent}
 	req.Header["Content-Type"] = []string{"application/json"}
-	req.Header["API-Key"] = []string{c.APIKey}
-
-	if c.HTTPClient == nil {
-		c.HTTPClient = &http.Client{}
+	if err := c.authenticator().Authenticate(context.WithValue(ctx, clientKey{}, c), req); err != nil {
+		return nil, err
 	}
 
-	c.HTTPClient.Timeout = 30 * time.Second
-
-	return c.HTTPClient.Do(req)
-}
-
-// DecodeBytes ..
-func (c *DynuClient) decodeBytes(input []byte) (string, error) {
-
-	buf := new(strings.Builder)
-	_, err := io.Copy(buf, bytes.NewBuffer(input))
-	if err != nil {
-		return "", err
+	start := time.Now()
+	resp, err := c.httpClient().Do(req)
+	code := 0
+	if err == nil {
+		code = resp.StatusCode
 	}
-
-	return buf.String(), nil
+	elapsed := time.Since(start)
+	observeRequest(endpoint, method, code, elapsed)
+	c.logger().V(DebugLevel).Info("Dynu API request", "method", method, "endpoint", endpoint, "status", code, "duration", elapsed.String())
+	return resp, err
 }
 
 // GetDomainID ...
 func (c *DynuClient) GetDomainID() (int, error) {
-	dnsURL := fmt.Sprintf("%s/dns/getroot/%s", dynuAPI, c.HostName)
+	return c.GetDomainIDWithContext(context.Background())
+}
 
-	klog.Info("\ndnsURL: \n", dnsURL, "\n\n")
-	resp, err := c.makeRequest(dnsURL, "GET", nil)
+// GetDomainIDWithContext is GetDomainID with a context that can cancel the
+// API call
+func (c *DynuClient) GetDomainIDWithContext(ctx context.Context) (int, error) {
+	domain, err := c.GetRootDomainWithContext(ctx, c.HostName)
 	if err != nil {
 		return -1, err
 	}
+	return domain.ID, nil
+}
 
-	defer resp.Body.Close()
-
-	var domain Domain
-
-	if resp.StatusCode == http.StatusOK {
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return -1, err
+// GetRootDomainWithContext returns the Dynu domain that hostname belongs to
+//   GET https://api.dynu.com/v2/dns/getroot/{hostname}
+func (c *DynuClient) GetRootDomainWithContext(ctx context.Context, hostname string) (_ *Domain, err error) {
+	ctx, span := startSpan(ctx, "GetRootDomain", AttrHostname.String(hostname))
+	defer func() { endSpan(span, err) }()
+	key := c.domainCacheKey(hostname)
+	if domain, found := c.domainCache().Get(key); found {
+		span.SetAttributes(AttrCached.Bool(true))
+		if domain == nil {
+			return nil, cachedDomainNotFound(hostname)
 		}
-		err = json.Unmarshal(bodyBytes, &domain)
-		if err != nil {
-			return -1, err
-		}
-		return domain.ID, nil
+		return domain, nil
 	}
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	respbody, err := c.decodeBytes(bodyBytes)
+	domain, err := c.getRootDomain(ctx, hostname)
 	if err == nil {
-		klog.Info("\nrespbody: \n", respbody, "\n\n")
+		span.SetAttributes(AttrDomainID.Int(domain.ID))
+		c.domainCache().Add(key, domain)
+	} else if errors.Is(err, ErrDomainNotFound) {
+		c.domainCache().Add(key, nil)
 	}
-
-	return -1, fmt.Errorf("Unable to find Domain ID \nError Type:%s\nError: %s", domain.Exception.Type, domain.Exception.Message)
+	return domain, err
 }
 
-// GetDNSRecord ...
-func (c *DynuClient) GetDNSRecord(domainID int, nodeName, textData string) (*DNSResponse, error) {
-	var dnsRecords DNSRecords
-	dnsURL := fmt.Sprintf("%s/dns/%d/record", dynuAPI, domainID)
-	var resp *http.Response
-
-	resp, err := c.makeRequest(dnsURL, "GET", nil)
+func (c *DynuClient) getRootDomain(ctx context.Context, hostname string) (*Domain, error) {
+	dnsURL := fmt.Sprintf("%s/dns/getroot/%s", c.baseURL(), hostname)
+	resp, err := c.makeRequest(ctx, dnsURL, "GET", nil)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusOK {
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		err = json.Unmarshal(bodyBytes, &dnsRecords)
-		if err != nil {
-			return nil, err
-		}
-		for _, rec := range dnsRecords.DNSRecords {
-			if rec.NodeName == nodeName && rec.TextData == textData {
-				return &rec, nil
-			}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := readAPIError(resp, ErrDomainNotFound)
+		// getroot's only argument is the hostname, so an argument error
+		// means Dynu doesn't manage it
+		if apiErr.kind == nil && strings.Contains(strings.ToLower(apiErr.Type), "argument") {
+			apiErr.kind = ErrDomainNotFound
 		}
+		return nil, apiErr
 	}
+	defer resp.Body.Close()
 
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	c.logResponseBody(bodyBytes)
-	return nil, fmt.Errorf("Unable to find DNS Records for Domain ID: %d", domainID)
-}
-
-func (c *DynuClient) logResponseBody(body []byte) {
-	_, file, no, ok := runtime.Caller(1)
-	if ok {
-		klog.Info(fmt.Sprintf("\n\ncalled from %s#%d\n\n", file, no))
+	if err != nil {
+		return nil, err
 	}
-	respbody, err := c.decodeBytes(body)
+	var domain Domain
+	err = json.Unmarshal(bodyBytes, &domain)
 	if err != nil {
-		klog.Error(fmt.Sprintf("Couldn't decode resonse body: %v", err))
+		return nil, err
+	}
+	if domain.StatusCode != 0 && domain.StatusCode != http.StatusOK {
+		return nil, newAPIError("GET", dnsURL, http.StatusOK, bodyBytes, ErrDomainNotFound)
 	}
-	klog.Info(fmt.Sprintf("\nResponseBody: %v\n", respbody))
+	return &domain, nil
+}
+
+// GetDNSRecord ...
+func (c *DynuClient) GetDNSRecord(domainID int, nodeName, textData string) (*DNSResponse, error) {
+	return c.GetDNSRecordWithContext(context.Background(), domainID, nodeName, textData)
+}
+
+// GetDNSRecordWithContext is GetDNSRecord with a context that can cancel the
+// API call. It has to list every record of the domain; prefer FindTXTRecord
+// when the domain's name is known.
+func (c *DynuClient) GetDNSRecordWithContext(ctx context.Context, domainID int, nodeName, textData string) (_ *DNSResponse, err error) {
+	ctx, span := startSpan(ctx, "GetDNSRecord", AttrDomainID.Int(domainID), AttrNodeName.String(nodeName))
+	defer func() { endSpan(span, err) }()
+	return c.findTXTRecord(ctx, domainID, "", nodeName, textData)
 }
@@ -1,14 +1,19 @@
 package dynuclient
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
 	guntest "github.com/gstore/cert-manager-webhook-dynu/test"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
 )
 
 var (
@@ -16,6 +21,9 @@ var (
 	apikey   = os.Getenv("DYNU_APIKEY")
 	nodeName = "txt"
 	txtData  = "123=="
+
+	// unlimited keeps tests from waiting on the package's default rate limit
+	unlimited = rate.NewLimiter(rate.Inf, 1)
 )
 
 func TestGetDomainID(t *testing.T) {
@@ -38,102 +46,119 @@ func TestGetDomainID(t *testing.T) {
 	assert.Nil(t, err, "error returned")
 }
 
+func TestGetDomainIDWithBaseURL(t *testing.T) {
+	hostName := "example.com"
+	expectedURL := fmt.Sprintf("/proxy/v2/dns/getroot/%s", hostName)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, expectedURL, req.URL.String(), "Should call %s but called %s", expectedURL, req.URL.String())
+		w.Write([]byte(`{"statusCode": 200,"id": 12345,"domainName": "example.com","hostname": "example.com","node": ""}`))
+	}))
+	defer srv.Close()
+
+	dynu := DynuClient{HostName: hostName, BaseURL: srv.URL + "/proxy/v2/"}
+	domainID, err := dynu.GetDomainID()
+	assert.Equal(t, 12345, domainID)
+	assert.Nil(t, err, "error returned")
+}
+
+func TestGetDomainIDCancelled(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	dynu := DynuClient{HostName: "example.com", BaseURL: srv.URL}
+	_, err := dynu.GetDomainIDWithContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, called, "request should not reach the API once cancelled")
+	assert.True(t, time.Since(start) < time.Second, "cancellation should interrupt the rate limit wait")
+}
+
+func TestValidateBaseURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{DefaultBaseURL, true},
+		{"http://127.0.0.1:8080/v2", true},
+		{"https://dynu-proxy.internal/v2/", true},
+		{"ftp://api.dynu.com/v2", false},
+		{"api.dynu.com/v2", false},
+		{"https:///v2", false},
+		{"https://api.dynu.com/v2?debug=1", false},
+		{"://bad", false},
+	}
+	for _, tt := range tests {
+		err := ValidateBaseURL(tt.url)
+		assert.Equal(t, tt.valid, err == nil, "ValidateBaseURL(%q) returned %v", tt.url, err)
+	}
+}
+
 func TestRemoveDNSRecord(t *testing.T) {
-	expectedMethod := "DELETE"
-	hostname := "example.com"
-	domainID := 98765
-	expectedURL := fmt.Sprintf("/v2/dns/%d/record/12345", domainID)
-	i := 0
-	testHandlerFunc := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		switch i {
-		case 0:
-			w.Write([]byte(`{}`))
-		case 1:
-			w.Write([]byte(fmt.Sprintf(`{"statusCode": 200,"id": %d,"domainName": "example.com","hostname": "example.com","node": ""}`, domainID)))
-		default:
-			assert.Equal(t, expectedURL, req.URL.String(), "Should call %s but called %s", expectedURL, req.URL.String())
-			assert.Equal(t, expectedMethod, req.Method, "Should be %s but got %s", expectedMethod, req.Method)
-			w.Write([]byte("ok"))
-		}
-		// if i == 0 {
-		// 	w.Write([]byte(fmt.Sprintf(`{"statusCode": 200,"id": %d,"domainName": "example.com","hostname": "example.com","node": ""}`, domainID)))
-		// } else {
-		// 	assert.Equal(t, expectedURL, req.URL.String(), "Should call %s but called %s", expectedURL, req.URL.String())
-		// 	assert.Equal(t, expectedMethod, req.Method, "Should be %s but got %s", expectedMethod, req.Method)
-		// 	w.Write([]byte("ok"))
-		// }
-		i++
-	})
-	client := &guntest.Testclient{}
-	httpClient, teardown := client.TestingHTTPClient(testHandlerFunc)
-	defer teardown()
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+	domainID := api.AddDomain("example.org")
+	keep := api.AddRecord(dynutest.Record{DomainID: domainID, NodeName: nodeName, RecordType: "TXT", TextData: "other==", State: true})
+	remove := api.AddRecord(dynutest.Record{DomainID: domainID, NodeName: nodeName, RecordType: "TXT", TextData: txtData, State: true})
 
-	dynu := DynuClient{HTTPClient: httpClient, HostName: hostname}
+	dynu := DynuClient{HostName: "example.org", APIKey: api.APIKey, BaseURL: api.URL, RateLimiter: unlimited}
 	err := dynu.RemoveDNSRecord(nodeName, txtData)
 	assert.Nil(t, err, "error returned")
+
+	expected := fmt.Sprintf("DELETE /v2/dns/%d/record/%d", domainID, remove)
+	assert.Contains(t, api.Requests(), expected, "Should call %s", expected)
+	if recs := api.Records(); assert.Len(t, recs, 1) {
+		assert.Equal(t, keep, recs[0].ID, "only the record with matching text should be removed")
+	}
+
+	// removing it again is a no-op
+	assert.Nil(t, dynu.RemoveDNSRecord(nodeName, txtData), "error returned")
 }
 
 func TestCreateDNSRecord(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
 
-	expectedMethod := "POST"
-	expectedRecordID := 987654
-	hostname := "example.com"
-	domainID := 98765
-	expectedURL := fmt.Sprintf("/v2/dns/%d/record", domainID)
-	i := 0
 	rec := DNSRecord{
 		NodeName:   nodeName,
 		RecordType: "TXT",
 		TextData:   txtData,
 		TTL:        "90",
-	}
-	dnsResp := DNSResponse{
-		StatusCode: 200,
-		ID:         expectedRecordID,
-		DomainName: "domainName",
-		NodeName:   nodeName,
-		Hostname:   "hostName",
-		RecordType: "TXT",
-		TTL:        90,
 		State:      true,
-		Content:    "content",
-		UpdatedOn:  "2020-10-29T23:00",
-		TextData:   txtData,
 	}
-	dnsResponse, _ := json.Marshal(dnsResp)
-	testHandlerFunc := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		switch i {
-		case 0:
-			w.Write([]byte(fmt.Sprintf(`{"statusCode": 200,"id": %d,"domainName": "example.com","hostname": "example.com","node": ""}`, domainID)))
-		case 1:
-			w.Write([]byte(`{}`))
-		default:
-			assert.Equal(t, expectedURL, req.URL.String(), "Should call %s but called %s", expectedURL, req.URL.String())
-			assert.Equal(t, expectedMethod, req.Method, "Should be %s but got %s", expectedMethod, req.Method)
-			w.Write([]byte(dnsResponse))
-		}
-
-		// if i == 0 {
-		// 	w.Write([]byte(fmt.Sprintf(`{"statusCode": 200,"id": %d,"domainName": "example.com","hostname": "example.com","node": ""}`, domainID)))
-		// } else {
-		// 	assert.Equal(t, expectedURL, req.URL.String(), "Should call %s but called %s", expectedURL, req.URL.String())
-		// 	assert.Equal(t, expectedMethod, req.Method, "Should be %s but got %s", expectedMethod, req.Method)
-		// 	w.Write([]byte(dnsResponse))
-		// }
-		i++
-	})
-
-	client := &guntest.Testclient{}
-	httpClient, teardown := client.TestingHTTPClient(testHandlerFunc)
-	defer teardown()
-	dynu := DynuClient{HTTPClient: httpClient, HostName: hostname}
+	dynu := DynuClient{HostName: "example.com", APIKey: api.APIKey, BaseURL: api.URL, RateLimiter: unlimited}
 	recordID, err := dynu.CreateDNSRecord(rec)
-	if err != nil {
-		fmt.Println("an error occured: ", err.Error())
-		return
+	assert.NoError(t, err)
+
+	recs := api.Records()
+	if assert.Len(t, recs, 1) {
+		assert.Equal(t, recs[0].ID, recordID, "RecordID expected %d got %d", recs[0].ID, recordID)
+		assert.Equal(t, "txt.example.com", recs[0].Hostname())
+		assert.Equal(t, txtData, recs[0].TextData)
+		assert.Equal(t, 90, recs[0].TTL)
 	}
+	assert.Equal(t, []string{txtData}, api.TXT("txt.example.com."))
+
+	// creating it again returns the existing record
+	again, err := dynu.CreateDNSRecord(rec)
+	assert.NoError(t, err)
+	assert.Equal(t, recordID, again)
+	assert.Len(t, api.Records(), 1)
+}
+
+func TestCreateDNSRecordUnauthorized(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
 
-	assert.Equal(t, expectedRecordID, recordID, "RecordID expected %d got %d", expectedRecordID, recordID)
+	dynu := DynuClient{HostName: "example.com", APIKey: "wrong", BaseURL: api.URL, RateLimiter: unlimited}
+	_, err := dynu.CreateDNSRecord(DNSRecord{NodeName: nodeName, RecordType: "TXT", TextData: txtData, TTL: "90"})
+	assert.True(t, errors.Is(err, ErrUnauthorized), "unexpected error %v", err)
+	assert.Empty(t, api.Records())
 }
 
 func TestAddAndRemoveRecord(t *testing.T) {
@@ -164,3 +189,19 @@ func TestAddAndRemoveRecord(t *testing.T) {
 	assert.NoError(t, err)
 	t.Logf("Removed DNSRecordID: %d", dnsrecordid)
 }
+
+func TestHTTPClientIsNotModified(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	dynu := DynuClient{HostName: "example.com", APIKey: api.APIKey, BaseURL: api.URL, RateLimiter: unlimited, HTTPClient: client}
+	_, err := dynu.ListDomains(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, client.Timeout, "the caller's timeout should be kept")
+
+	dynu.HTTPClient = nil
+	_, err = dynu.ListDomains(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, dynu.HTTPClient, "the default client should be used without setting it")
+}
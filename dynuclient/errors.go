@@ -0,0 +1,112 @@
+package dynuclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrDomainNotFound is returned when Dynu has no root domain for a
+	// hostname or domain ID
+	ErrDomainNotFound = errors.New("dynu: domain not found")
+	// ErrRecordNotFound is returned when a DNS record doesn't exist
+	ErrRecordNotFound = errors.New("dynu: DNS record not found")
+	// ErrUnauthorized is returned when Dynu rejects the credentials
+	ErrUnauthorized = errors.New("dynu: unauthorized")
+	// ErrRateLimited is returned when Dynu keeps throttling requests
+	ErrRateLimited = errors.New("dynu: rate limited")
+)
+
+// APIError is an error response from the Dynu API. Use errors.Is with the
+// Err* sentinels to classify it.
+type APIError struct {
+	// StatusCode is the HTTP status, or the statusCode from the body when
+	// Dynu reports an error with a 200 response
+	StatusCode int
+	// Type is Dynu's exception type, e.g. "Authentication Exception"
+	Type    string
+	Message string
+	Method  string
+	URL     string
+	// Attempts is the number of times the request was sent
+	Attempts int
+
+	kind error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("dynu: %s %s returned %d", e.Method, e.URL, e.StatusCode)
+	if e.Type != "" {
+		msg += " " + e.Type
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Attempts > 1 {
+		msg += fmt.Sprintf(" (after %d attempts)", e.Attempts)
+	}
+	return msg
+}
+
+// Unwrap returns the sentinel the error was classified as, if any
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// apiErrorBody is the JSON Dynu sends with failed requests. Some endpoints
+// nest it under "exception".
+type apiErrorBody struct {
+	StatusCode int           `json:"statusCode"`
+	Type       string        `json:"type"`
+	Message    string        `json:"message"`
+	Exception  *APIException `json:"exception"`
+}
+
+// newAPIError builds an APIError from a failed response. notFound is the
+// sentinel to use when the response means the requested object is missing.
+func newAPIError(method, URL string, statusCode int, body []byte, notFound error) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Method: method, URL: URL, Attempts: 1}
+
+	var parsed apiErrorBody
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		apiErr.Type, apiErr.Message = parsed.Type, parsed.Message
+		if parsed.Exception != nil {
+			apiErr.Type, apiErr.Message = parsed.Exception.Type, parsed.Exception.Message
+		}
+		if statusCode == http.StatusOK && parsed.StatusCode != 0 {
+			apiErr.StatusCode = parsed.StatusCode
+		}
+	} else if len(body) > 0 {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	apiErr.kind = classify(apiErr, notFound)
+	return apiErr
+}
+
+// readAPIError reads and closes resp.Body and returns it as an APIError
+func readAPIError(resp *http.Response, notFound error) *APIError {
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return newAPIError(resp.Request.Method, resp.Request.URL.String(), resp.StatusCode, body, notFound)
+}
+
+func classify(e *APIError, notFound error) error {
+	typ := strings.ToLower(e.Type)
+	msg := strings.ToLower(e.Message)
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden ||
+		strings.Contains(typ, "authentication"):
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests || strings.Contains(typ, "rate limit"):
+		return ErrRateLimited
+	case notFound != nil && (e.StatusCode == http.StatusNotFound ||
+		strings.Contains(msg, "not found") || strings.Contains(msg, "unable to find") ||
+		strings.Contains(msg, "does not exist")):
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package dynuclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		notFound   error
+		kind       error
+		typ        string
+		message    string
+	}{
+		{"unauthorized", 401, `{"statusCode":401,"type":"Authentication Exception","message":"Invalid API key."}`, nil, ErrUnauthorized, "Authentication Exception", "Invalid API key."},
+		{"authentication in body", 501, `{"statusCode":501,"type":"Authentication Exception","message":"Access denied."}`, ErrDomainNotFound, ErrUnauthorized, "Authentication Exception", "Access denied."},
+		{"rate limited", 429, `{"statusCode":429,"type":"Rate Limit Exception","message":"Too many requests."}`, nil, ErrRateLimited, "Rate Limit Exception", "Too many requests."},
+		{"nested exception", 404, `{"statusCode":404,"exception":{"statusCode":404,"type":"Not Found Exception","message":"Domain not found."}}`, ErrDomainNotFound, ErrDomainNotFound, "Not Found Exception", "Domain not found."},
+		{"record not found", 501, `{"statusCode":501,"type":"Argument Exception","message":"Unable to find DNS record."}`, ErrRecordNotFound, ErrRecordNotFound, "Argument Exception", "Unable to find DNS record."},
+		{"plain text body", 500, "internal error\n", ErrDomainNotFound, nil, "", "internal error"},
+		{"validation error", 501, `{"statusCode":501,"type":"Validation Exception","message":"TTL is invalid."}`, ErrRecordNotFound, nil, "Validation Exception", "TTL is invalid."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newAPIError("GET", "https://api.dynu.com/v2/dns", tt.statusCode, []byte(tt.body), tt.notFound)
+			assert.Equal(t, tt.statusCode, err.StatusCode)
+			assert.Equal(t, tt.typ, err.Type)
+			assert.Equal(t, tt.message, err.Message)
+			if tt.kind == nil {
+				assert.Nil(t, errors.Unwrap(err))
+			} else {
+				assert.True(t, errors.Is(err, tt.kind), "%v should be %v", err, tt.kind)
+			}
+		})
+	}
+}
+
+func TestGetDomainIDNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte(`{"statusCode":501,"type":"Argument Exception","message":"Host name is invalid."}`))
+	}))
+	defer srv.Close()
+
+	_, err := newRetryTestClient(srv.URL).GetDomainID()
+	assert.True(t, errors.Is(err, ErrDomainNotFound), "unexpected error %v", err)
+
+	var apiErr *APIError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, http.StatusNotImplemented, apiErr.StatusCode)
+		assert.Equal(t, "Argument Exception", apiErr.Type)
+		assert.Equal(t, 1, apiErr.Attempts)
+	}
+}
+
+func TestRateLimitedAfterRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	_, err := newRetryTestClient(srv.URL).GetDomainID()
+	assert.True(t, errors.Is(err, ErrRateLimited), "unexpected error %v", err)
+
+	var apiErr *APIError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, fastRetries.MaxAttempts, apiErr.Attempts)
+	}
+}
+
+func TestRemoveDNSRecordUnauthorized(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"statusCode":401,"type":"Authentication Exception","message":"Invalid API key."}`))
+	}))
+	defer srv.Close()
+
+	err := newRetryTestClient(srv.URL).RemoveDNSRecord("txt", "123==")
+	assert.True(t, errors.Is(err, ErrUnauthorized), "unexpected error %v", err)
+}
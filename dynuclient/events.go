@@ -0,0 +1,49 @@
+package dynuclient
+
+import "time"
+
+// EventKind says what an Event reports
+type EventKind string
+
+const (
+	// EventRecordCreated is sent when a TXT record was created
+	EventRecordCreated EventKind = "RecordCreated"
+	// EventRecordExists is sent when a TXT record to be created was already
+	// there
+	EventRecordExists EventKind = "RecordExists"
+	// EventRecordDeleted is sent when a record was deleted
+	EventRecordDeleted EventKind = "RecordDeleted"
+	// EventRecordGone is sent when a record to be deleted was already gone
+	EventRecordGone EventKind = "RecordGone"
+	// EventRetry is sent before a failed request is repeated
+	EventRetry EventKind = "Retry"
+)
+
+// Event reports something a client did that the people waiting on it may
+// want to know about, see DynuClient.OnEvent
+type Event struct {
+	Kind     EventKind
+	DomainID int
+	// DomainName is only set when the client knows it without a lookup
+	DomainName string
+	// RecordID is 0 when the record isn't known
+	RecordID int
+
+	// The fields below describe the failed attempt of an EventRetry
+	Method   string
+	Endpoint string
+	// Reason is the status or error of the attempt
+	Reason string
+	// RateLimited is set when Dynu answered 429 Too Many Requests
+	RateLimited bool
+	Delay       time.Duration
+	Attempt     int
+	MaxAttempts int
+}
+
+// emit passes e to the client's OnEvent, if any
+func (c *DynuClient) emit(e Event) {
+	if c.OnEvent != nil {
+		c.OnEvent(e)
+	}
+}
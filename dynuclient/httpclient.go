@@ -0,0 +1,38 @@
+package dynuclient
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds the requests of the default HTTP client
+const DefaultTimeout = 30 * time.Second
+
+var (
+	httpClientMu      sync.RWMutex
+	defaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+)
+
+// SetDefaultHTTPClient changes the HTTP client used by clients that don't
+// set DynuClient.HTTPClient, and by OAuth2Auth to fetch tokens
+func SetDefaultHTTPClient(client *http.Client) {
+	httpClientMu.Lock()
+	defer httpClientMu.Unlock()
+	defaultHTTPClient = client
+}
+
+// DefaultHTTPClient returns the client set with SetDefaultHTTPClient
+func DefaultHTTPClient() *http.Client {
+	httpClientMu.RLock()
+	defer httpClientMu.RUnlock()
+	return defaultHTTPClient
+}
+
+// httpClient returns the client this DynuClient sends requests with
+func (c *DynuClient) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return DefaultHTTPClient()
+}
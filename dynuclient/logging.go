@@ -0,0 +1,142 @@
+package dynuclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2/klogr"
+)
+
+// Verbosity levels of the client's log messages. They match the levels
+// cert-manager logs at, so one -v flag tunes both.
+const (
+	InfoLevel         = 2
+	ExtendedInfoLevel = 3
+	DebugLevel        = 4
+	TraceLevel        = 5
+)
+
+var (
+	loggerMu      sync.RWMutex
+	defaultLogger logr.Logger = klogr.New().WithName("dynuclient")
+
+	// redactionDisabled is set when secrets may be logged as they are
+	redactionDisabled int32
+)
+
+// SetDefaultLogger replaces the logger of clients that don't set
+// DynuClient.Log, and of OAuth2Auth
+func SetDefaultLogger(log logr.Logger) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	defaultLogger = log
+}
+
+// DefaultLogger returns the logger set with SetDefaultLogger
+func DefaultLogger() logr.Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return defaultLogger
+}
+
+// logger returns the logger this client writes to
+func (c *DynuClient) logger() logr.Logger {
+	if c.Log != nil {
+		return c.Log
+	}
+	return DefaultLogger()
+}
+
+// SetRedaction turns the redaction of API keys, tokens and challenge values
+// in log messages on or off. It is on unless turned off, which is only meant
+// for debugging against a test account.
+func SetRedaction(enabled bool) {
+	var v int32
+	if !enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&redactionDisabled, v)
+}
+
+func redacting() bool {
+	return atomic.LoadInt32(&redactionDisabled) == 0
+}
+
+// Redacted wraps a secret for logging. While redaction is on it is logged as
+// a short fingerprint, so equal values can still be matched up across log
+// lines.
+type Redacted string
+
+func (r Redacted) String() string {
+	if r == "" || !redacting() {
+		return string(r)
+	}
+	return "[redacted " + fingerprint(string(r))[:8] + "]"
+}
+
+// MarshalJSON makes loggers that encode values as JSON, like klogr, log the
+// redacted form
+func (r Redacted) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// redactedFields are masked in logged response bodies wherever they appear.
+// content is only masked in TXT records, where it repeats textData.
+var redactedFields = map[string]bool{
+	"textdata":      true,
+	"access_token":  true,
+	"apikey":        true,
+	"client_secret": true,
+}
+
+// responseBody is a Dynu response body as it's logged, with the fields in
+// redactedFields masked while redaction is on
+type responseBody []byte
+
+func (b responseBody) String() string {
+	if !redacting() {
+		return string(b)
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Sprintf("[%d bytes, not JSON]", len(b))
+	}
+	redactValue(v)
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("[%d bytes]", len(b))
+	}
+	return string(out)
+}
+
+func (b responseBody) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.String())
+}
+
+func redactValue(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		txt := false
+		if t, ok := v["recordType"].(string); ok {
+			txt = strings.EqualFold(t, RecordTypeTXT)
+		}
+		for key, value := range v {
+			if s, ok := value.(string); ok {
+				lower := strings.ToLower(key)
+				if redactedFields[lower] || (txt && lower == "content") {
+					v[key] = Redacted(s).String()
+				}
+				continue
+			}
+			redactValue(value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			redactValue(value)
+		}
+	}
+}
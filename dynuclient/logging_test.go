@@ -0,0 +1,110 @@
+package dynuclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingLogger keeps every message, at any level, formatted as
+// "msg key=value ..."
+type recordingLogger struct {
+	lock   *sync.Mutex
+	lines  *[]string
+	values []interface{}
+}
+
+func newRecordingLogger() *recordingLogger {
+	return &recordingLogger{lock: &sync.Mutex{}, lines: &[]string{}}
+}
+
+func (l *recordingLogger) Enabled() bool { return true }
+
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	line := msg
+	kvs := append(append([]interface{}{}, l.values...), keysAndValues...)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		line += fmt.Sprintf(" %v=%v", kvs[i], kvs[i+1])
+	}
+	*l.lines = append(*l.lines, line)
+}
+
+func (l *recordingLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.Info(msg, append(keysAndValues, "error", err)...)
+}
+
+func (l *recordingLogger) V(level int) logr.Logger { return l }
+
+func (l *recordingLogger) WithName(name string) logr.Logger { return l }
+
+func (l *recordingLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	return &recordingLogger{lock: l.lock, lines: l.lines, values: append(append([]interface{}{}, l.values...), keysAndValues...)}
+}
+
+func (l *recordingLogger) output() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return strings.Join(*l.lines, "\n")
+}
+
+func TestRedacted(t *testing.T) {
+	defer SetRedaction(true)
+
+	secret := Redacted("s3cr3t-api-key")
+	assert.NotContains(t, secret.String(), "s3cr3t")
+	assert.Equal(t, secret.String(), Redacted("s3cr3t-api-key").String(), "equal values should be logged alike")
+	assert.NotEqual(t, secret.String(), Redacted("other-api-key").String())
+	assert.Equal(t, "", Redacted("").String())
+	out, err := json.Marshal(secret)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(out), "s3cr3t")
+
+	SetRedaction(false)
+	assert.Equal(t, "s3cr3t-api-key", secret.String())
+	out, err = json.Marshal(secret)
+	assert.NoError(t, err)
+	assert.Equal(t, `"s3cr3t-api-key"`, string(out))
+}
+
+func TestResponseBody(t *testing.T) {
+	defer SetRedaction(true)
+
+	body := responseBody(`{"statusCode": 200, "dnsRecords": [
+		{"id": 1, "recordType": "TXT", "textData": "challenge-key", "content": "_acme-challenge.example.com. 300 IN TXT \"challenge-key\""},
+		{"id": 2, "recordType": "A", "ipv4Address": "192.0.2.1", "content": "www.example.com. 300 IN A 192.0.2.1"}
+	], "access_token": "bearer-token"}`)
+	logged := body.String()
+	assert.NotContains(t, logged, "challenge-key")
+	assert.NotContains(t, logged, "bearer-token")
+	assert.Contains(t, logged, "192.0.2.1", "only secrets should be masked")
+	assert.Equal(t, "[7 bytes, not JSON]", responseBody("tea pot").String())
+
+	SetRedaction(false)
+	assert.Contains(t, body.String(), "challenge-key")
+}
+
+func TestCreateDNSRecordLogging(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+	log := newRecordingLogger()
+	dynu := DynuClient{HostName: "example.com", APIKey: api.APIKey, BaseURL: api.URL, RateLimiter: unlimited, Log: log}
+
+	recordID, err := dynu.CreateDNSRecord(DNSRecord{NodeName: nodeName, RecordType: "TXT", TextData: txtData, TTL: "90", State: true})
+	assert.NoError(t, err)
+	assert.NoError(t, dynu.RemoveDNSRecord(nodeName, txtData))
+
+	output := log.output()
+	assert.NotContains(t, output, txtData, "the challenge key should be redacted")
+	assert.NotContains(t, output, api.APIKey)
+	assert.Contains(t, output, fmt.Sprintf("created TXT record hostname=example.com node=%s domainID=%d recordID=%d", nodeName, api.Domains()[0].ID, recordID))
+	assert.Contains(t, output, "value="+Redacted(txtData).String())
+	assert.Contains(t, output, "Dynu API request")
+}
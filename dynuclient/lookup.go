@@ -0,0 +1,148 @@
+package dynuclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostnameLookupRetryInterval is how long an API base URL that doesn't offer
+// /dns/record/{hostname} is sent straight to the domain listing before the
+// endpoint is probed again
+const HostnameLookupRetryInterval = time.Hour
+
+// hostnameLookupUnsupported records the API base URLs that don't offer
+// hostname lookups, so they are only probed once per retry interval
+var hostnameLookupUnsupported = &unsupportedEndpoints{ttl: HostnameLookupRetryInterval, now: time.Now}
+
+// unsupportedEndpoints remembers base URLs for ttl
+type unsupportedEndpoints struct {
+	ttl time.Duration
+	now func() time.Time
+
+	lock  sync.Mutex
+	until map[string]time.Time
+}
+
+func (u *unsupportedEndpoints) contains(base string) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	until, ok := u.until[base]
+	if ok && !u.now().Before(until) {
+		delete(u.until, base)
+		return false
+	}
+	return ok
+}
+
+func (u *unsupportedEndpoints) add(base string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.until == nil {
+		u.until = map[string]time.Time{}
+	}
+	u.until[base] = u.now().Add(u.ttl)
+}
+
+// FindTXTRecord returns the TXT record at zone.NodeName holding textData, or
+// an error matching ErrRecordNotFound. It asks Dynu for the TXT records of
+// just that hostname and only lists the whole domain when that isn't
+// possible.
+func (c *DynuClient) FindTXTRecord(ctx context.Context, zone *Zone, textData string) (_ *DNSResponse, err error) {
+	ctx, span := startSpan(ctx, "FindTXTRecord", AttrDomainID.Int(zone.DomainID), AttrNodeName.String(zone.NodeName))
+	defer func() { endSpan(span, err) }()
+	return c.findTXTRecord(ctx, zone.DomainID, zone.DomainName, zone.NodeName, textData)
+}
+
+// findTXTRecord looks up a TXT record by node name, which is compared
+// case-insensitively, and text. domainName may be empty, in which case the
+// whole domain is listed.
+func (c *DynuClient) findTXTRecord(ctx context.Context, domainID int, domainName, nodeName, textData string) (*DNSResponse, error) {
+	var (
+		dnsRecords []DNSResponse
+		err        error
+	)
+	if domainName != "" {
+		dnsRecords, err = c.hostnameRecords(ctx, domainName, nodeName, RecordTypeTXT)
+		if canFallBack(err) {
+			if err != errFallback {
+				c.logger().V(ExtendedInfoLevel).Info("hostname record lookup failed, listing the whole domain instead", "domainID", domainID, "error", err.Error())
+			}
+			dnsRecords, err = c.listRecords(ctx, domainID)
+		}
+	} else {
+		dnsRecords, err = c.listRecords(ctx, domainID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range dnsRecords {
+		if rec.DomainID != 0 && rec.DomainID != domainID {
+			continue
+		}
+		if strings.EqualFold(rec.RecordType, RecordTypeTXT) && strings.EqualFold(rec.NodeName, nodeName) && rec.TextData == textData {
+			return &rec, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no TXT record for node %q in domain %d", ErrRecordNotFound, nodeName, domainID)
+}
+
+// errFallback is returned by hostnameRecords when the API doesn't offer
+// hostname lookups
+var errFallback = errors.New("hostname record lookup unsupported")
+
+// canFallBack reports whether a failed hostname lookup may still succeed by
+// listing the whole domain. Credential and rate limit errors would just
+// repeat.
+func canFallBack(err error) bool {
+	if err == errFallback {
+		return true
+	}
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && !errors.Is(err, ErrUnauthorized) && !errors.Is(err, ErrRateLimited)
+}
+
+// hostnameRecords returns the records of one type at nodeName within
+// domainName
+//   GET https://api.dynu.com/v2/dns/record/{hostname}?recordType={type}
+func (c *DynuClient) hostnameRecords(ctx context.Context, domainName, nodeName, recordType string) ([]DNSResponse, error) {
+	base := c.baseURL()
+	if hostnameLookupUnsupported.contains(base) {
+		return nil, errFallback
+	}
+	hostname := strings.TrimSuffix(domainName, ".")
+	if nodeName != "" {
+		hostname = nodeName + "." + hostname
+	}
+	dnsURL := fmt.Sprintf("%s/dns/record/%s?recordType=%s", base, url.PathEscape(hostname), url.QueryEscape(recordType))
+	resp, err := c.makeRequest(ctx, dnsURL, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		err := newAPIError(resp.Request.Method, resp.Request.URL.String(), resp.StatusCode, body, nil)
+		// Dynu answers a hostname it has no records for with a JSON 404, which
+		// says nothing about the endpoint; only a 405, or a 404 that didn't
+		// come from the API itself, means it doesn't exist
+		if resp.StatusCode == http.StatusNotFound && json.Valid(body) {
+			return nil, err
+		}
+		c.logger().V(InfoLevel).Info("Dynu API has no hostname record lookup, listing whole domains instead", "url", base, "error", err.Error())
+		hostnameLookupUnsupported.add(base)
+		return nil, errFallback
+	}
+	var dnsRecords DNSRecords
+	if err := decodeResponse(resp, nil, &dnsRecords); err != nil {
+		return nil, err
+	}
+	return dnsRecords.DNSRecords, nil
+}
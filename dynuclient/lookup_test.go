@@ -0,0 +1,130 @@
+package dynuclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindTXTRecord(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+	dynu := newRetryTestClient(api.URL)
+	dynu.APIKey = api.APIKey
+	ctx := context.Background()
+
+	id := api.AddRecord(dynutest.Record{DomainID: 1001, NodeName: "_acme-challenge.www", RecordType: "TXT", TextData: "123d==", State: true})
+	api.AddRecord(dynutest.Record{DomainID: 1001, NodeName: "_acme-challenge.www", RecordType: "TXT", TextData: "other", State: true})
+	api.AddRecord(dynutest.Record{DomainID: 1001, NodeName: "www", RecordType: "A", IPv4Address: "192.0.2.1", State: true})
+
+	zone := &Zone{DomainID: 1001, DomainName: "example.com", NodeName: "_ACME-Challenge.WWW"}
+	before := len(api.Requests())
+	rec, err := dynu.FindTXTRecord(ctx, zone, "123d==")
+	if assert.NoError(t, err) {
+		assert.Equal(t, id, rec.ID)
+	}
+	assert.Equal(t, []string{"GET /v2/dns/record/_ACME-Challenge.WWW.example.com"}, api.Requests()[before:],
+		"only the hostname's records should be fetched")
+
+	_, err = dynu.FindTXTRecord(ctx, zone, "123D==")
+	assert.True(t, errors.Is(err, ErrRecordNotFound), "the text should match exactly, got %v", err)
+	_, err = dynu.FindTXTRecord(ctx, &Zone{DomainID: 1001, DomainName: "example.com", NodeName: "www"}, "192.0.2.1")
+	assert.True(t, errors.Is(err, ErrRecordNotFound), "only TXT records should match, got %v", err)
+
+	rec, err = dynu.GetDNSRecordWithContext(ctx, 1001, "_acme-challenge.WWW", "123d==")
+	if assert.NoError(t, err, "node names should match case-insensitively without a domain name too") {
+		assert.Equal(t, id, rec.ID)
+	}
+}
+
+func TestFindTXTRecordFallsBack(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+	api.NoHostnameLookup = true
+	dynu := newRetryTestClient(api.URL)
+	dynu.APIKey = api.APIKey
+	ctx := context.Background()
+	id := api.AddRecord(dynutest.Record{DomainID: 1001, NodeName: "_acme-challenge", RecordType: "TXT", TextData: "123d==", State: true})
+
+	zone := &Zone{DomainID: 1001, DomainName: "example.com", NodeName: "_acme-challenge"}
+	for i := 0; i < 2; i++ {
+		rec, err := dynu.FindTXTRecord(ctx, zone, "123d==")
+		if assert.NoError(t, err) {
+			assert.Equal(t, id, rec.ID)
+		}
+	}
+	assert.Equal(t, []string{
+		"GET /v2/dns/record/_acme-challenge.example.com",
+		"GET /v2/dns/1001/record",
+		"GET /v2/dns/1001/record",
+	}, api.Requests(), "a missing endpoint should only be probed once")
+
+	// and probed again once the retry interval has passed
+	hostnameLookupUnsupported.now = func() time.Time { return time.Now().Add(HostnameLookupRetryInterval) }
+	defer func() { hostnameLookupUnsupported.now = time.Now }()
+	before := len(api.Requests())
+	_, err := dynu.FindTXTRecord(ctx, zone, "123d==")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET /v2/dns/record/_acme-challenge.example.com", "GET /v2/dns/1001/record"}, api.Requests()[before:])
+
+	// a hostname Dynu rejects falls back for that call only
+	api2 := dynutest.NewServer("test-api-key", "example.com")
+	defer api2.Close()
+	dynu.BaseURL = api2.URL
+	_, err = dynu.FindTXTRecord(ctx, &Zone{DomainID: 1001, DomainName: "example.org", NodeName: "_acme-challenge"}, "123d==")
+	assert.True(t, errors.Is(err, ErrRecordNotFound), "got %v", err)
+	assert.Equal(t, []string{"GET /v2/dns/record/_acme-challenge.example.org", "GET /v2/dns/1001/record"}, api2.Requests())
+
+	dynu.APIKey = "wrong"
+	before = len(api2.Requests())
+	_, err = dynu.FindTXTRecord(ctx, zone, "123d==")
+	assert.True(t, errors.Is(err, ErrUnauthorized), "got %v", err)
+	assert.Len(t, api2.Requests()[before:], 1, "credential errors shouldn't fall back")
+}
+
+func TestFindTXTRecordKeepsHostnameLookupAfterNotFound(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		requests []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		requests = append(requests, req.URL.Path)
+		first := len(requests) == 1
+		lock.Unlock()
+		switch {
+		case req.URL.Path == "/dns/1001/record":
+			fmt.Fprint(w, `{"statusCode": 200, "dnsRecords": []}`)
+		case first:
+			// Dynu's own answer for a hostname it has no records for
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"statusCode": 404, "type": "Not Found Exception", "message": "Hostname not found."}`)
+		default:
+			fmt.Fprint(w, `{"statusCode": 200, "dnsRecords": [{"id": 7, "domainId": 1001, "nodeName": "_acme-challenge", "recordType": "TXT", "textData": "123d==", "state": true}]}`)
+		}
+	}))
+	defer srv.Close()
+	dynu := newRetryTestClient(srv.URL)
+	ctx := context.Background()
+
+	zone := &Zone{DomainID: 1001, DomainName: "example.com", NodeName: "_acme-challenge"}
+	_, err := dynu.FindTXTRecord(ctx, zone, "123d==")
+	assert.True(t, errors.Is(err, ErrRecordNotFound), "got %v", err)
+	rec, err := dynu.FindTXTRecord(ctx, zone, "123d==")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 7, rec.ID)
+	}
+	assert.Equal(t, []string{
+		"/dns/record/_acme-challenge.example.com",
+		"/dns/1001/record",
+		"/dns/record/_acme-challenge.example.com",
+	}, requests, "a 404 from the API for one hostname shouldn't disable hostname lookups")
+}
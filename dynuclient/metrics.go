@@ -0,0 +1,98 @@
+package dynuclient
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dynu",
+		Subsystem: "api",
+		Name:      "requests_total",
+		Help:      "Dynu API requests by endpoint, method and status code. The code is \"error\" when no response was received.",
+	}, []string{"endpoint", "method", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "dynu",
+		Subsystem: "api",
+		Name:      "request_duration_seconds",
+		Help:      "Time until Dynu answered a request, by endpoint, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "method", "code"})
+
+	rateLimiterWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "dynu",
+		Subsystem: "api",
+		Name:      "rate_limiter_wait_seconds",
+		Help:      "Time requests waited for the Dynu API rate limiter.",
+		Buckets:   []float64{0.001, 0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	})
+
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dynu",
+		Subsystem: "api",
+		Name:      "retries_total",
+		Help:      "Dynu API requests repeated after a failed attempt, by endpoint and method.",
+	}, []string{"endpoint", "method"})
+)
+
+// RegisterMetrics registers the Prometheus metrics of all DynuClients with reg
+func RegisterMetrics(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{requestsTotal, requestDuration, rateLimiterWait, retriesTotal} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeRequest records one attempt at a request; code is 0 when it failed
+// without a response
+func observeRequest(endpoint, method string, code int, elapsed time.Duration) {
+	status := "error"
+	if code != 0 {
+		status = strconv.Itoa(code)
+	}
+	requestsTotal.WithLabelValues(endpoint, method, status).Inc()
+	requestDuration.WithLabelValues(endpoint, method, status).Observe(elapsed.Seconds())
+}
+
+// endpoint turns a request URL into its path template below the base URL,
+// e.g. /dns/{id}/record/{id}, so metrics don't get a series per record
+func (c *DynuClient) endpoint(URL string) string {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return "unknown"
+	}
+	path := u.EscapedPath()
+	if base, err := url.Parse(c.baseURL()); err == nil {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(base.EscapedPath(), "/"))
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, s := range segments {
+		switch {
+		case s == "":
+		case isNumeric(s):
+			segments[i] = "{id}"
+		case i > 0 && segments[i-1] == "getroot",
+			// GET /dns/record/{hostname}
+			i == 2 && segments[0] == "dns" && segments[1] == "record":
+			segments[i] = "{hostname}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
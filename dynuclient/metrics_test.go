@@ -0,0 +1,60 @@
+package dynuclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpoint(t *testing.T) {
+	dynu := DynuClient{BaseURL: "https://dynu.example/v2/"}
+	for url, want := range map[string]string{
+		"https://dynu.example/v2/dns":                                       "/dns",
+		"https://dynu.example/v2/dns/98765":                                 "/dns/{id}",
+		"https://dynu.example/v2/dns/getroot/www.example.com":               "/dns/getroot/{hostname}",
+		"https://dynu.example/v2/dns/98765/record":                          "/dns/{id}/record",
+		"https://dynu.example/v2/dns/98765/record/12345":                    "/dns/{id}/record/{id}",
+		"https://dynu.example/v2/dns/record/www.example.com?recordType=TXT": "/dns/record/{hostname}",
+	} {
+		assert.Equal(t, want, dynu.endpoint(url), url)
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"statusCode": 200,"id": 12345,"domainName": "example.com","hostname": "example.com","node": ""}`))
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewPedanticRegistry()
+	assert.NoError(t, RegisterMetrics(reg))
+	assert.Error(t, RegisterMetrics(reg), "metrics can only be registered once per registry")
+
+	requests := func(code string) float64 {
+		return testutil.ToFloat64(requestsTotal.WithLabelValues("/dns/getroot/{hostname}", "GET", code))
+	}
+	ok, unavailable := requests("200"), requests("503")
+	retries := testutil.ToFloat64(retriesTotal.WithLabelValues("/dns/getroot/{hostname}", "GET"))
+
+	dynu := DynuClient{HostName: "example.com", BaseURL: srv.URL, RateLimiter: unlimited, RetryPolicy: fastRetries, DomainCache: NoDomainCache}
+	_, err := dynu.GetDomainID()
+	assert.NoError(t, err)
+
+	assert.Equal(t, ok+1, requests("200"))
+	assert.Equal(t, unavailable+1, requests("503"))
+	assert.Equal(t, retries+1, testutil.ToFloat64(retriesTotal.WithLabelValues("/dns/getroot/{hostname}", "GET")))
+
+	problems, err := testutil.GatherAndLint(reg)
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+}
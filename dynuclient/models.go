@@ -1,6 +1,10 @@
 package dynuclient
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/go-logr/logr"
+)
 
 // DNSRecord ...
 type DNSRecord struct {
@@ -10,6 +14,8 @@ type DNSRecord struct {
 	TTL        string `json:"ttl"`
 	DomainID   int    `json:"domainId,omitempty"`
 	State      bool   `json:"state,omitempty"`
+	// DomainName optionally names the domain of DomainID
+	DomainName string `json:"-"`
 }
 
 // DNSResponse ...
@@ -21,24 +27,63 @@ type DNSResponse struct {
 	NodeName   string `json:"nodeName"`
 	Hostname   string `json:"hostname"`
 	RecordType string `json:"recordType"`
-	TTL        int16  `json:"ttl"`
+	TTL        int    `json:"ttl"`
 	State      bool   `json:"state"`
 	Content    string `json:"content"`
 	UpdatedOn  string `json:"updatedOn"`
 	TextData   string `json:"textData"`
+
+	// type-specific fields, see the typed Record structs
+	IPv4Address string `json:"ipv4Address,omitempty"`
+	IPv6Address string `json:"ipv6Address,omitempty"`
+	Host        string `json:"host,omitempty"`
+	Priority    int    `json:"priority,omitempty"`
+	Weight      int    `json:"weight,omitempty"`
+	Port        int    `json:"port,omitempty"`
+	Flags       int    `json:"flags,omitempty"`
+	Tag         string `json:"tag,omitempty"`
+	Value       string `json:"value,omitempty"`
 }
 
 // DynuClient ... options for DynuClient
 type DynuClient struct {
+	// HTTPClient sends requests; nil means the default client, see
+	// SetDefaultHTTPClient. Its Timeout bounds each attempt.
 	HTTPClient *http.Client
-	HostName   string
-	UserAgent  string
-	APIKey     string
+	// BaseURL overrides DefaultBaseURL, e.g. to reach a proxy or a fake API
+	BaseURL   string
+	HostName  string
+	UserAgent string
+	// APIKey authenticates requests unless Auth is set
+	APIKey string
+	// Auth supplies the credentials for requests, e.g. an *OAuth2Auth; nil
+	// means APIKeyAuth with APIKey
+	Auth Authenticator
+	// RateLimiter throttles requests; nil means the process-wide default
+	// limiter, see SetDefaultRateLimit. Setting it replaces that limiter, so
+	// chain it with DefaultLimiter to keep the process-wide budget.
+	RateLimiter Limiter
+	// RetryPolicy controls retries of failed requests; nil means
+	// DefaultRetryPolicy
+	RetryPolicy *RetryPolicy
+	// DomainCache remembers root domain lookups; nil means the process-wide
+	// default cache, see SetDefaultDomainCache
+	DomainCache DomainCache
+	// Log receives the client's log messages; nil means the default logger,
+	// see SetDefaultLogger
+	Log logr.Logger
+	// OnEvent, if set, is called with each Event while the client works,
+	// e.g. to report progress on the resource a record is created for. It
+	// is called synchronously, so it should return quickly.
+	OnEvent func(Event)
 }
 
-// DynuCreds - Details required to access API
+// DynuCreds - Details required to access API, either an API key or an
+// OAuth2 client ID and secret
 type DynuCreds struct {
-	APIKey string
+	APIKey       string
+	ClientID     string
+	ClientSecret string
 }
 
 // APIException ...
@@ -56,6 +101,34 @@ type Domain struct {
 	DomainName string       `json:"domainName"`
 	Node       string       `json:"node"`
 	Exception  APIException `json:"exception"`
+
+	// The fields below are only set by ListDomains and GetDomain, which
+	// also copy Name to DomainName
+
+	Name        string `json:"name,omitempty"`
+	UnicodeName string `json:"unicodeName,omitempty"`
+	State       string `json:"state,omitempty"`
+	Group       string `json:"group,omitempty"`
+	// TTL is the default TTL in seconds of the domain's records
+	TTL         int    `json:"ttl,omitempty"`
+	IPv4Address string `json:"ipv4Address,omitempty"`
+	IPv6Address string `json:"ipv6Address,omitempty"`
+	// IPv4 and IPv6 enable the domain's address records
+	IPv4              bool     `json:"ipv4"`
+	IPv6              bool     `json:"ipv6"`
+	IPv4WildcardAlias bool     `json:"ipv4WildcardAlias"`
+	IPv6WildcardAlias bool     `json:"ipv6WildcardAlias"`
+	AllowZoneTransfer bool     `json:"allowZoneTransfer"`
+	DNSSEC            bool     `json:"dnssec"`
+	NameServers       []string `json:"nameServers,omitempty"`
+	CreatedOn         string   `json:"createdOn,omitempty"`
+	UpdatedOn         string   `json:"updatedOn,omitempty"`
+}
+
+// Domains ...
+type Domains struct {
+	StatusCode int      `json:"statusCode,omitempty"`
+	Domains    []Domain `json:"domains,omitempty"`
 }
 
 // DNSRecords ...
@@ -0,0 +1,151 @@
+package dynuclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultRateLimit is the sustained number of Dynu API requests per second
+// allowed across the whole process
+const DefaultRateLimit float64 = 1
+
+// DefaultRateBurst is the number of Dynu API requests that may be made back
+// to back before DefaultRateLimit applies
+const DefaultRateBurst int = 5
+
+// Limiter throttles Dynu API requests; *rate.Limiter implements it
+type Limiter interface {
+	// Wait blocks until a request may be sent or ctx is done
+	Wait(ctx context.Context) error
+}
+
+// ChainLimiters returns a Limiter that waits until every one of limiters
+// allows a request, e.g. an issuer's own budget on top of the process-wide
+// one. Tokens are reserved from all of them at once and handed back if any
+// can't be had before ctx is done, so a request held up by a narrow budget
+// doesn't also use up the wider ones. Limiters other than *rate.Limiter are
+// waited for in turn, in the order given, before the reservations.
+func ChainLimiters(limiters ...Limiter) Limiter {
+	return limiterChain(limiters)
+}
+
+type limiterChain []Limiter
+
+func (c limiterChain) Wait(ctx context.Context) error {
+	var buckets []*rate.Limiter
+	for _, l := range c {
+		if bucket, ok := l.(*rate.Limiter); ok {
+			buckets = append(buckets, bucket)
+		} else if err := l.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, len(buckets))
+	cancel := func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+	var delay time.Duration
+	for _, bucket := range buckets {
+		r := bucket.ReserveN(now, 1)
+		if !r.OK() {
+			cancel()
+			return fmt.Errorf("rate: Wait(n=1) exceeds limiter's burst %d", bucket.Burst())
+		}
+		reservations = append(reservations, r)
+		if d := r.DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		cancel()
+		return fmt.Errorf("rate: Wait(n=1) would exceed context deadline")
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+}
+
+type limiterKey struct {
+	limit float64
+	burst int
+}
+
+var (
+	limitersMu   sync.Mutex
+	limiters     = map[limiterKey]*rate.Limiter{}
+	defaultLimit = limiterKey{limit: DefaultRateLimit, burst: DefaultRateBurst}
+)
+
+// ValidateRateLimit checks that limit and burst describe a usable token bucket
+func ValidateRateLimit(limit float64, burst int) error {
+	if limit <= 0 {
+		return fmt.Errorf("rate limit must be greater than 0, got %v", limit)
+	}
+	if burst < 1 {
+		return fmt.Errorf("rate burst must be at least 1, got %d", burst)
+	}
+	return nil
+}
+
+// SetDefaultRateLimit changes the token bucket used by clients that don't set
+// DynuClient.RateLimiter
+func SetDefaultRateLimit(limit float64, burst int) error {
+	if err := ValidateRateLimit(limit, burst); err != nil {
+		return err
+	}
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	defaultLimit = limiterKey{limit: limit, burst: burst}
+	return nil
+}
+
+// SharedLimiter returns the process-wide token bucket for limit and burst.
+// Every caller asking for the same settings gets the same limiter, so all
+// DynuClients configured alike draw from a single budget.
+func SharedLimiter(limit float64, burst int) *rate.Limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	return sharedLimiter(limiterKey{limit: limit, burst: burst})
+}
+
+// DefaultLimiter returns the shared token bucket for the current default
+// rate limit settings
+func DefaultLimiter() *rate.Limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	return sharedLimiter(defaultLimit)
+}
+
+func sharedLimiter(key limiterKey) *rate.Limiter {
+	l, ok := limiters[key]
+	if !ok {
+		l = rate.NewLimiter(rate.Limit(key.limit), key.burst)
+		limiters[key] = l
+	}
+	return l
+}
+
+// limiter returns the token bucket this client draws from
+func (c *DynuClient) limiter() Limiter {
+	if c.RateLimiter != nil {
+		return c.RateLimiter
+	}
+	return DefaultLimiter()
+}
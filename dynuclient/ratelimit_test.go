@@ -0,0 +1,77 @@
+package dynuclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestSharedLimiter(t *testing.T) {
+	a := SharedLimiter(3, 7)
+	b := SharedLimiter(3, 7)
+	assert.True(t, a == b, "limiters with the same settings should be shared")
+	assert.False(t, a == SharedLimiter(3, 8), "limiters with different settings should not be shared")
+
+	assert.Error(t, SetDefaultRateLimit(0, 1))
+	assert.Error(t, SetDefaultRateLimit(1, 0))
+}
+
+func TestChainLimiters(t *testing.T) {
+	open, closed := rate.NewLimiter(rate.Inf, 1), rate.NewLimiter(rate.Every(time.Hour), 1)
+	chain := ChainLimiters(open, closed)
+	assert.NoError(t, chain.Wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, chain.Wait(ctx), "every limiter of the chain should be waited for")
+}
+
+func TestChainLimitersReturnsUnusedTokens(t *testing.T) {
+	global, issuer := rate.NewLimiter(rate.Every(time.Hour), 2), rate.NewLimiter(rate.Every(time.Hour), 1)
+	chain := ChainLimiters(global, issuer)
+	assert.NoError(t, chain.Wait(context.Background()))
+
+	// the issuer's budget is spent, so its deadline can't be met
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, chain.Wait(ctx))
+	assert.True(t, global.Allow(), "a request the issuer holds back shouldn't use the global budget")
+
+	// and without a deadline, until it's cancelled
+	global, issuer = rate.NewLimiter(rate.Every(time.Hour), 2), rate.NewLimiter(rate.Every(time.Hour), 1)
+	chain = ChainLimiters(global, issuer)
+	assert.NoError(t, chain.Wait(context.Background()))
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	assert.Error(t, chain.Wait(ctx))
+	assert.True(t, global.Allow(), "a cancelled wait should hand its global token back")
+}
+
+func TestRateLimiterOnlyBlocksOverBudget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"statusCode": 200,"id": 12345,"domainName": "example.com","hostname": "example.com","node": ""}`))
+	}))
+	defer srv.Close()
+
+	dynu := DynuClient{HostName: "example.com", BaseURL: srv.URL, RateLimiter: rate.NewLimiter(rate.Every(time.Hour), 2), DomainCache: NoDomainCache}
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		_, err := dynu.GetDomainID()
+		assert.NoError(t, err)
+	}
+	assert.True(t, time.Since(start) < time.Second, "requests within the burst should not wait")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := dynu.GetDomainIDWithContext(ctx)
+	assert.Error(t, err, "requests over budget should wait for a token")
+}
@@ -0,0 +1,375 @@
+package dynuclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Record types with a typed representation
+const (
+	RecordTypeA     = "A"
+	RecordTypeAAAA  = "AAAA"
+	RecordTypeCNAME = "CNAME"
+	RecordTypeMX    = "MX"
+	RecordTypeSRV   = "SRV"
+	RecordTypeCAA   = "CAA"
+	RecordTypeTXT   = "TXT"
+)
+
+// RecordHeader holds the fields every Dynu DNS record has
+type RecordHeader struct {
+	ID       int
+	DomainID int
+	// NodeName is the name relative to the domain, e.g. "www", or "" at the
+	// apex
+	NodeName string
+	// TTL in seconds; 0 leaves it to Dynu's default
+	TTL int
+	// State enables the record. Dynu keeps disabled records but doesn't
+	// serve them.
+	State bool
+
+	// Hostname, Content and UpdatedOn are set by Dynu and ignored when
+	// creating or updating records
+	Hostname  string
+	Content   string
+	UpdatedOn string
+}
+
+func (h *RecordHeader) header() *RecordHeader { return h }
+
+// Record is a DNS record of one of the typed record structs, e.g. *ARecord
+type Record interface {
+	// Type is the Dynu record type, e.g. "A"
+	Type() string
+
+	header() *RecordHeader
+	// data returns the type-specific fields as sent to Dynu
+	data() map[string]interface{}
+}
+
+// ARecord maps a name to an IPv4 address
+type ARecord struct {
+	RecordHeader
+	IPv4Address string
+}
+
+// Type implements Record
+func (r *ARecord) Type() string { return RecordTypeA }
+
+func (r *ARecord) data() map[string]interface{} {
+	return map[string]interface{}{"ipv4Address": r.IPv4Address}
+}
+
+// AAAARecord maps a name to an IPv6 address
+type AAAARecord struct {
+	RecordHeader
+	IPv6Address string
+}
+
+// Type implements Record
+func (r *AAAARecord) Type() string { return RecordTypeAAAA }
+
+func (r *AAAARecord) data() map[string]interface{} {
+	return map[string]interface{}{"ipv6Address": r.IPv6Address}
+}
+
+// CNAMERecord aliases a name to Host
+type CNAMERecord struct {
+	RecordHeader
+	Host string
+}
+
+// Type implements Record
+func (r *CNAMERecord) Type() string { return RecordTypeCNAME }
+
+func (r *CNAMERecord) data() map[string]interface{} {
+	return map[string]interface{}{"host": r.Host}
+}
+
+// MXRecord names a mail server for the domain
+type MXRecord struct {
+	RecordHeader
+	Host     string
+	Priority int
+}
+
+// Type implements Record
+func (r *MXRecord) Type() string { return RecordTypeMX }
+
+func (r *MXRecord) data() map[string]interface{} {
+	return map[string]interface{}{"host": r.Host, "priority": r.Priority}
+}
+
+// SRVRecord locates a service. NodeName carries the service and protocol
+// labels, e.g. "_sip._tcp".
+type SRVRecord struct {
+	RecordHeader
+	Host     string
+	Priority int
+	Weight   int
+	Port     int
+}
+
+// Type implements Record
+func (r *SRVRecord) Type() string { return RecordTypeSRV }
+
+func (r *SRVRecord) data() map[string]interface{} {
+	return map[string]interface{}{"host": r.Host, "priority": r.Priority, "weight": r.Weight, "port": r.Port}
+}
+
+// CAARecord restricts which certificate authorities may issue for a name
+type CAARecord struct {
+	RecordHeader
+	Flags int
+	// Tag is "issue", "issuewild" or "iodef"
+	Tag   string
+	Value string
+}
+
+// Type implements Record
+func (r *CAARecord) Type() string { return RecordTypeCAA }
+
+func (r *CAARecord) data() map[string]interface{} {
+	return map[string]interface{}{"flags": r.Flags, "tag": r.Tag, "value": r.Value}
+}
+
+// TXTRecord holds free-form text, e.g. an ACME challenge
+type TXTRecord struct {
+	RecordHeader
+	TextData string
+}
+
+// Type implements Record
+func (r *TXTRecord) Type() string { return RecordTypeTXT }
+
+func (r *TXTRecord) data() map[string]interface{} {
+	return map[string]interface{}{"textData": r.TextData}
+}
+
+// OtherRecord is a record of a type without a typed struct. Only its
+// rendered Content is available.
+type OtherRecord struct {
+	RecordHeader
+	RecordType string
+}
+
+// Type implements Record
+func (r *OtherRecord) Type() string { return r.RecordType }
+
+func (r *OtherRecord) data() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+// recordFromResponse converts a record as returned by Dynu to its typed form
+func recordFromResponse(resp DNSResponse) Record {
+	h := RecordHeader{
+		ID:        resp.ID,
+		DomainID:  resp.DomainID,
+		NodeName:  resp.NodeName,
+		TTL:       resp.TTL,
+		State:     resp.State,
+		Hostname:  resp.Hostname,
+		Content:   resp.Content,
+		UpdatedOn: resp.UpdatedOn,
+	}
+	switch strings.ToUpper(resp.RecordType) {
+	case RecordTypeA:
+		return &ARecord{RecordHeader: h, IPv4Address: resp.IPv4Address}
+	case RecordTypeAAAA:
+		return &AAAARecord{RecordHeader: h, IPv6Address: resp.IPv6Address}
+	case RecordTypeCNAME:
+		return &CNAMERecord{RecordHeader: h, Host: resp.Host}
+	case RecordTypeMX:
+		return &MXRecord{RecordHeader: h, Host: resp.Host, Priority: resp.Priority}
+	case RecordTypeSRV:
+		return &SRVRecord{RecordHeader: h, Host: resp.Host, Priority: resp.Priority, Weight: resp.Weight, Port: resp.Port}
+	case RecordTypeCAA:
+		return &CAARecord{RecordHeader: h, Flags: resp.Flags, Tag: resp.Tag, Value: resp.Value}
+	case RecordTypeTXT:
+		return &TXTRecord{RecordHeader: h, TextData: resp.TextData}
+	}
+	return &OtherRecord{RecordHeader: h, RecordType: resp.RecordType}
+}
+
+// recordBody returns the JSON Dynu expects to create or update rec
+func recordBody(rec Record) ([]byte, error) {
+	if _, ok := rec.(*OtherRecord); ok {
+		return nil, fmt.Errorf("can't write %s records, they have no typed representation", rec.Type())
+	}
+	h := rec.header()
+	body := rec.data()
+	body["nodeName"] = h.NodeName
+	body["recordType"] = rec.Type()
+	body["state"] = h.State
+	if h.TTL != 0 {
+		body["ttl"] = h.TTL
+	}
+	return json.Marshal(body)
+}
+
+// sameRecord reports whether a and b have the same name, type and data
+func sameRecord(a, b Record) bool {
+	return a.Type() == b.Type() &&
+		strings.EqualFold(a.header().NodeName, b.header().NodeName) &&
+		reflect.DeepEqual(a.data(), b.data())
+}
+
+// ListRecords returns every DNS record of a domain
+//   GET https://api.dynu.com/v2/dns/{DNSID}/record
+func (c *DynuClient) ListRecords(ctx context.Context, domainID int) (_ []Record, err error) {
+	ctx, span := startSpan(ctx, "ListRecords", AttrDomainID.Int(domainID))
+	defer func() { endSpan(span, err) }()
+	resps, err := c.listRecords(ctx, domainID)
+	if err != nil {
+		return nil, err
+	}
+	recs := make([]Record, 0, len(resps))
+	for _, resp := range resps {
+		recs = append(recs, recordFromResponse(resp))
+	}
+	return recs, nil
+}
+
+func (c *DynuClient) listRecords(ctx context.Context, domainID int) ([]DNSResponse, error) {
+	dnsURL := fmt.Sprintf("%s/dns/%d/record", c.baseURL(), domainID)
+	resp, err := c.makeRequest(ctx, dnsURL, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	var dnsRecords DNSRecords
+	if err := decodeResponse(resp, ErrDomainNotFound, &dnsRecords); err != nil {
+		return nil, c.forgetDomain(domainID, err)
+	}
+	return dnsRecords.DNSRecords, nil
+}
+
+// GetRecord returns a DNS record by ID, or an error matching
+// ErrRecordNotFound if it doesn't exist
+//   GET https://api.dynu.com/v2/dns/{DNSID}/record/{DNSRecordID}
+func (c *DynuClient) GetRecord(ctx context.Context, domainID, recordID int) (_ Record, err error) {
+	ctx, span := startSpan(ctx, "GetRecord", AttrDomainID.Int(domainID), AttrRecordID.Int(recordID))
+	defer func() { endSpan(span, err) }()
+	dnsURL := fmt.Sprintf("%s/dns/%d/record/%d", c.baseURL(), domainID, recordID)
+	resp, err := c.makeRequest(ctx, dnsURL, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	var dnsResp DNSResponse
+	if err := decodeResponse(resp, ErrRecordNotFound, &dnsResp); err != nil {
+		return nil, err
+	}
+	return recordFromResponse(dnsResp), nil
+}
+
+// CreateRecord adds rec to a domain and returns the record as stored by
+// Dynu. rec's ID and DomainID are ignored.
+//   POST https://api.dynu.com/v2/dns/{DNSID}/record
+func (c *DynuClient) CreateRecord(ctx context.Context, domainID int, rec Record) (_ Record, err error) {
+	ctx, span := startSpan(ctx, "CreateRecord", AttrDomainID.Int(domainID), AttrNodeName.String(rec.header().NodeName), AttrRecordType.String(rec.Type()))
+	defer func() { endSpan(span, err) }()
+	body, err := recordBody(rec)
+	if err != nil {
+		return nil, err
+	}
+	dnsURL := fmt.Sprintf("%s/dns/%d/record", c.baseURL(), domainID)
+
+	// POST isn't idempotent, so only retry it once we know the previous
+	// attempt didn't create the record after all
+	var existing Record
+	resp, err := c.withRetry(ctx, "POST", dnsURL, body, func(ctx context.Context) bool {
+		recs, err := c.ListRecords(ctx, domainID)
+		if err != nil {
+			return false
+		}
+		for _, r := range recs {
+			if sameRecord(r, rec) {
+				existing = r
+				return true
+			}
+		}
+		return false
+	})
+	if errors.Is(err, errAlreadyApplied) {
+		return existing, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var dnsResp DNSResponse
+	if err := decodeResponse(resp, ErrDomainNotFound, &dnsResp); err != nil {
+		return nil, c.forgetDomain(domainID, err)
+	}
+	return recordFromResponse(dnsResp), nil
+}
+
+// UpdateRecord replaces the record with rec's ID in a domain and returns the
+// record as stored by Dynu
+//   POST https://api.dynu.com/v2/dns/{DNSID}/record/{DNSRecordID}
+func (c *DynuClient) UpdateRecord(ctx context.Context, domainID int, rec Record) (_ Record, err error) {
+	ctx, span := startSpan(ctx, "UpdateRecord", AttrDomainID.Int(domainID), AttrRecordID.Int(rec.header().ID), AttrRecordType.String(rec.Type()))
+	defer func() { endSpan(span, err) }()
+	if rec.header().ID == 0 {
+		return nil, fmt.Errorf("can't update a %s record without an ID", rec.Type())
+	}
+	body, err := recordBody(rec)
+	if err != nil {
+		return nil, err
+	}
+	dnsURL := fmt.Sprintf("%s/dns/%d/record/%d", c.baseURL(), domainID, rec.header().ID)
+
+	// an update overwrites the whole record, so sending it again is harmless
+	resp, err := c.withRetry(ctx, "POST", dnsURL, body, func(context.Context) bool { return false })
+	if err != nil {
+		return nil, err
+	}
+	var dnsResp DNSResponse
+	if err := decodeResponse(resp, ErrRecordNotFound, &dnsResp); err != nil {
+		return nil, err
+	}
+	return recordFromResponse(dnsResp), nil
+}
+
+// DeleteRecord removes a DNS record by ID, or returns an error matching
+// ErrRecordNotFound if it doesn't exist
+//   DELETE https://api.dynu.com/v2/dns/{DNSID}/record/{DNSRecordID}
+func (c *DynuClient) DeleteRecord(ctx context.Context, domainID, recordID int) (err error) {
+	ctx, span := startSpan(ctx, "DeleteRecord", AttrDomainID.Int(domainID), AttrRecordID.Int(recordID))
+	defer func() { endSpan(span, err) }()
+	dnsURL := fmt.Sprintf("%s/dns/%d/record/%d", c.baseURL(), domainID, recordID)
+	resp, err := c.makeRequest(ctx, dnsURL, "DELETE", nil)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, ErrRecordNotFound, nil)
+}
+
+// decodeResponse reads and closes resp.Body. A successful body is decoded
+// into out, if given; a failed request, including one Dynu answered with
+// 200 but an error statusCode, is returned as an *APIError.
+func decodeResponse(resp *http.Response, notFound error, out interface{}) error {
+	if resp.StatusCode != http.StatusOK {
+		return readAPIError(resp, notFound)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var status struct {
+		StatusCode int `json:"statusCode"`
+	}
+	if err := json.Unmarshal(body, &status); err == nil && status.StatusCode != 0 && status.StatusCode != http.StatusOK {
+		return newAPIError(resp.Request.Method, resp.Request.URL.String(), http.StatusOK, body, notFound)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,126 @@
+package dynuclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordCRUD(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+	dynu := newRetryTestClient(api.URL)
+	dynu.APIKey = api.APIKey
+	ctx := context.Background()
+	const domainID = 1001
+
+	recs := []Record{
+		&ARecord{RecordHeader: RecordHeader{NodeName: "www", TTL: 120, State: true}, IPv4Address: "192.0.2.1"},
+		&AAAARecord{RecordHeader: RecordHeader{NodeName: "www", State: true}, IPv6Address: "2001:db8::1"},
+		&CNAMERecord{RecordHeader: RecordHeader{NodeName: "ftp", State: true}, Host: "www.example.com"},
+		&MXRecord{RecordHeader: RecordHeader{State: true}, Host: "mail.example.com", Priority: 10},
+		&SRVRecord{RecordHeader: RecordHeader{NodeName: "_sip._tcp", State: true}, Host: "sip.example.com", Priority: 1, Weight: 5, Port: 5060},
+		&CAARecord{RecordHeader: RecordHeader{State: true}, Tag: "issue", Value: "letsencrypt.org"},
+		&TXTRecord{RecordHeader: RecordHeader{NodeName: "_acme-challenge", State: true}, TextData: "123d=="},
+	}
+	var created []Record
+	for _, rec := range recs {
+		got, err := dynu.CreateRecord(ctx, domainID, rec)
+		if !assert.NoError(t, err, rec.Type()) {
+			continue
+		}
+		assert.IsType(t, rec, got)
+		assert.NotZero(t, got.header().ID)
+		assert.Equal(t, domainID, got.header().DomainID)
+		assert.True(t, sameRecord(rec, got), "%s record came back as %+v", rec.Type(), got)
+		created = append(created, got)
+	}
+	assert.Equal(t, 120, created[0].header().TTL)
+	assert.Equal(t, "www.example.com", created[0].header().Hostname)
+
+	listed, err := dynu.ListRecords(ctx, domainID)
+	assert.NoError(t, err)
+	assert.Equal(t, created, listed)
+
+	a := created[0].(*ARecord)
+	got, err := dynu.GetRecord(ctx, domainID, a.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, a, got)
+
+	a.IPv4Address = "192.0.2.2"
+	a.State = false
+	got, err = dynu.UpdateRecord(ctx, domainID, a)
+	if assert.NoError(t, err) {
+		assert.Equal(t, a.ID, got.header().ID)
+		assert.Equal(t, "192.0.2.2", got.(*ARecord).IPv4Address)
+		assert.False(t, got.header().State)
+	}
+
+	assert.NoError(t, dynu.DeleteRecord(ctx, domainID, a.ID))
+	_, err = dynu.GetRecord(ctx, domainID, a.ID)
+	assert.True(t, errors.Is(err, ErrRecordNotFound), "got %v", err)
+	err = dynu.DeleteRecord(ctx, domainID, a.ID)
+	assert.True(t, errors.Is(err, ErrRecordNotFound), "got %v", err)
+	_, err = dynu.UpdateRecord(ctx, domainID, a)
+	assert.True(t, errors.Is(err, ErrRecordNotFound), "got %v", err)
+	assert.Len(t, api.Records(), len(recs)-1)
+
+	_, err = dynu.ListRecords(ctx, 999)
+	assert.True(t, errors.Is(err, ErrDomainNotFound), "got %v", err)
+	_, err = dynu.CreateRecord(ctx, domainID, &ARecord{IPv4Address: "not an address"})
+	assert.Error(t, err)
+	_, err = dynu.UpdateRecord(ctx, domainID, &ARecord{IPv4Address: "192.0.2.3"})
+	assert.Error(t, err, "updating a record without an ID")
+	_, err = dynu.CreateRecord(ctx, domainID, &OtherRecord{RecordType: "NS"})
+	assert.Error(t, err)
+}
+
+func TestRecordFromResponse(t *testing.T) {
+	rec := recordFromResponse(DNSResponse{ID: 1, RecordType: "NS", Content: "example.com. 300 IN NS ns1.dynu.com."})
+	if assert.IsType(t, &OtherRecord{}, rec) {
+		assert.Equal(t, "NS", rec.Type())
+		assert.Equal(t, "example.com. 300 IN NS ns1.dynu.com.", rec.header().Content)
+	}
+	assert.IsType(t, &MXRecord{}, recordFromResponse(DNSResponse{RecordType: "mx"}))
+}
+
+func TestCreateRecordDedupesRetries(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+	// the first POST reaches Dynu but its response is lost
+	var posts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxied, _ := http.NewRequest(req.Method, strings.TrimSuffix(api.URL, "/v2")+req.URL.Path, req.Body)
+		proxied.Header = req.Header
+		resp, err := http.DefaultClient.Do(proxied)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if req.Method == http.MethodPost && atomic.AddInt32(&posts, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer srv.Close()
+	dynu := newRetryTestClient(srv.URL + "/v2")
+	dynu.APIKey = api.APIKey
+
+	rec, err := dynu.CreateRecord(context.Background(), 1001, &CNAMERecord{RecordHeader: RecordHeader{NodeName: "www", State: true}, Host: "example.net"})
+	assert.NoError(t, err)
+	assert.Len(t, api.Records(), 1)
+	if assert.NotNil(t, rec) {
+		assert.Equal(t, api.Records()[0].ID, rec.header().ID)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&posts))
+}
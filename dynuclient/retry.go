@@ -0,0 +1,165 @@
+package dynuclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how requests that failed with a transport error, a
+// 429 or a 5xx response are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, including the first one
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry; it doubles on every
+	// further attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between two attempts. A Retry-After header
+	// sent by Dynu takes precedence.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used by clients that don't set DynuClient.RetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// errAlreadyApplied is returned by withRetry when a non-idempotent request
+// is not re-sent because its dedupe check found the earlier attempt succeeded
+var errAlreadyApplied = errors.New("request already applied by an earlier attempt")
+
+func (c *DynuClient) retryPolicy() RetryPolicy {
+	if c.RetryPolicy != nil {
+		return *c.RetryPolicy
+	}
+	return DefaultRetryPolicy
+}
+
+// withRetry sends a request until it succeeds, fails with a non-retryable
+// status or the retry policy is exhausted. Only idempotent methods are
+// re-sent blindly; other methods are retried only when dedupe is given and
+// reports that the previous attempt did not take effect.
+func (c *DynuClient) withRetry(ctx context.Context, method, URL string, body []byte, dedupe func(context.Context) bool) (*http.Response, error) {
+	policy := c.retryPolicy()
+	canRetry := isIdempotent(method) || dedupe != nil
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, URL, body)
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if !shouldRetry(resp, err) {
+			return resp, err
+		}
+		if !canRetry || attempt >= policy.MaxAttempts {
+			if attempt == 1 {
+				return resp, err
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s %s failed after %d attempts: %w", method, URL, attempt, err)
+			}
+			apiErr := readAPIError(resp, nil)
+			apiErr.Attempts = attempt
+			return nil, apiErr
+		}
+
+		delay := policy.backoff(attempt)
+		reason, rateLimited := "", false
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason, rateLimited = resp.Status, resp.StatusCode == http.StatusTooManyRequests
+			if after, ok := retryAfter(resp); ok {
+				delay = after
+			}
+			resp.Body.Close()
+		}
+		endpoint := c.endpoint(URL)
+		c.logger().V(InfoLevel).Info("retrying Dynu API request", "method", method, "endpoint", endpoint, "reason", reason, "delay", delay.String(), "attempt", attempt, "maxAttempts", policy.MaxAttempts)
+		retriesTotal.WithLabelValues(endpoint, method).Inc()
+		c.emit(Event{
+			Kind:        EventRetry,
+			Method:      method,
+			Endpoint:    endpoint,
+			Reason:      reason,
+			RateLimited: rateLimited,
+			Delay:       delay,
+			Attempt:     attempt,
+			MaxAttempts: policy.MaxAttempts,
+		})
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if dedupe != nil && dedupe(ctx) {
+			return nil, errAlreadyApplied
+		}
+	}
+}
+
+// backoff returns the jittered delay before retry number attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	// pick a random delay in [delay/2, delay] so concurrent callers spread out
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// shouldRetry reports whether a request failed in a way that may succeed if
+// repeated
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		// rejected OAuth2 client credentials won't become valid
+		return !errors.Is(err, ErrUnauthorized)
+	}
+	// Dynu answers 501 for argument and validation errors, which won't go away
+	// on their own
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented)
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header, given either in seconds or as an
+// HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
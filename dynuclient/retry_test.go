@@ -0,0 +1,134 @@
+package dynuclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fastRetries = &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func newRetryTestClient(url string) *DynuClient {
+	return &DynuClient{
+		HostName:    "example.com",
+		BaseURL:     url,
+		RateLimiter: unlimited,
+		RetryPolicy: fastRetries,
+	}
+}
+
+func TestRetryIdempotentRequest(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"statusCode": 200,"id": 12345,"domainName": "example.com","hostname": "example.com","node": ""}`))
+	}))
+	defer srv.Close()
+
+	domainID, err := newRetryTestClient(srv.URL).GetDomainID()
+	assert.NoError(t, err)
+	assert.Equal(t, 12345, domainID)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	var events []Event
+	dynu := newRetryTestClient(srv.URL)
+	dynu.OnEvent = func(e Event) { events = append(events, e) }
+	_, err := dynu.GetDomainID()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "after 3 attempts")
+	assert.Equal(t, 3, calls)
+	if assert.Len(t, events, 2, "each retry should be reported") {
+		assert.Equal(t, EventRetry, events[0].Kind)
+		assert.True(t, events[0].RateLimited)
+		assert.Equal(t, "/dns/getroot/{hostname}", events[0].Endpoint)
+		assert.Equal(t, 2, events[1].Attempt)
+		assert.Equal(t, 3, events[1].MaxAttempts)
+	}
+}
+
+func TestRetryHonoursRetryAfter(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"statusCode": 200,"id": 12345,"domainName": "example.com","hostname": "example.com","node": ""}`))
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	_, err := newRetryTestClient(srv.URL).GetDomainID()
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= time.Second, "Retry-After should override the backoff")
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := newRetryTestClient(srv.URL).GetDomainIDWithContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestRetryCreateIsDeduplicated(t *testing.T) {
+	posts := 0
+	listed := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.HasPrefix(req.URL.Path, "/dns/getroot/"):
+			w.Write([]byte(`{"statusCode": 200,"id": 98765,"domainName": "example.com","hostname": "example.com","node": ""}`))
+		case req.Method == http.MethodGet:
+			listed++
+			if listed == 1 {
+				w.Write([]byte(`{"statusCode": 200,"dnsRecords": []}`))
+				return
+			}
+			// the first POST went through even though Dynu answered 502
+			w.Write([]byte(`{"statusCode": 200,"dnsRecords": [{"id": 555,"nodeName": "txt","recordType": "TXT","textData": "123=="}]}`))
+		case req.Method == http.MethodPost:
+			posts++
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	recordID, err := newRetryTestClient(srv.URL).CreateDNSRecord(DNSRecord{NodeName: "txt", RecordType: "TXT", TextData: "123=="})
+	assert.NoError(t, err)
+	assert.Equal(t, 555, recordID)
+	assert.Equal(t, 1, posts, "POST should not be re-sent once the record exists")
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 1; attempt < 10; attempt++ {
+		d := p.backoff(attempt)
+		assert.True(t, d <= p.MaxDelay, "attempt %d: %v exceeds max delay", attempt, d)
+		assert.True(t, d >= p.BaseDelay/2, "attempt %d: %v is below half the base delay", attempt, d)
+	}
+}
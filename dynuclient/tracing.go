@@ -0,0 +1,60 @@
+package dynuclient
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of the spans DynuClient starts
+const TracerName = "github.com/gstore/cert-manager-webhook-dynu/dynuclient"
+
+// Span attributes set by DynuClient
+const (
+	AttrDomainID = attribute.Key("dynu.domain_id")
+	AttrRecordID = attribute.Key("dynu.record_id")
+	AttrHostname = attribute.Key("dynu.hostname")
+	AttrNodeName = attribute.Key("dynu.node_name")
+	// AttrRecordType is the type of the record created or updated
+	AttrRecordType = attribute.Key("dynu.record_type")
+	// AttrCached is set when the result was served from a cache
+	AttrCached = attribute.Key("dynu.cached")
+)
+
+// startSpan starts a span for the DynuClient method name using the global
+// tracer provider, which does nothing until one is installed
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, "dynu."+name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// endpointKey carries a request's endpoint template to the transport
+type endpointKey struct{}
+
+// NewTransport wraps base, or http.DefaultTransport when it's nil, so that
+// every Dynu API request gets a client span named after its endpoint and
+// carries the trace context of the call that made it
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base, otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+		if endpoint, ok := req.Context().Value(endpointKey{}).(string); ok {
+			return "HTTP " + req.Method + " " + endpoint
+		}
+		return "HTTP " + req.Method
+	}))
+}
@@ -0,0 +1,53 @@
+package dynuclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"statusCode": 404, "type": "Not Found", "message": "record not found"}`))
+	}))
+	defer srv.Close()
+
+	dynu := DynuClient{BaseURL: srv.URL + "/v2", HTTPClient: &http.Client{Transport: NewTransport(nil)}}
+	err := dynu.DeleteRecord(context.Background(), 98765, 12345)
+	assert.Error(t, err)
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	request, method := spans[0], spans[1]
+	assert.Equal(t, "HTTP DELETE /dns/{id}/record/{id}", request.Name)
+	assert.Equal(t, trace.SpanKindClient, request.SpanKind)
+	assert.Equal(t, method.SpanContext.SpanID(), request.Parent.SpanID())
+	assert.Contains(t, traceparent, request.SpanContext.TraceID().String(), "the trace context should be sent to Dynu")
+
+	assert.Equal(t, "dynu.DeleteRecord", method.Name)
+	assert.Equal(t, codes.Error, method.Status.Code)
+	assert.Contains(t, method.Attributes, AttrDomainID.Int(98765))
+	assert.Contains(t, method.Attributes, AttrRecordID.Int(12345))
+}
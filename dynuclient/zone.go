@@ -0,0 +1,106 @@
+package dynuclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Zone locates a DNS name within the Dynu domain that is authoritative for it
+type Zone struct {
+	DomainID   int
+	DomainName string
+	// NodeName is the name relative to DomainName, e.g. "_acme-challenge.www"
+	// for _acme-challenge.www.example.com, and "" at the apex
+	NodeName string
+}
+
+// ResolveZone asks Dynu which of the account's domains fqdn belongs to and
+// returns the node name to create records for fqdn with. It handles names at
+// any depth below the root domain, including delegated subdomains registered
+// as domains of their own.
+func (c *DynuClient) ResolveZone(ctx context.Context, fqdn string) (_ *Zone, err error) {
+	ctx, span := startSpan(ctx, "ResolveZone", AttrHostname.String(fqdn))
+	defer func() { endSpan(span, err) }()
+	hostname, err := rootLookupName(fqdn)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := c.GetRootDomainWithContext(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	nodeName, err := SplitFQDN(fqdn, domain.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(AttrDomainID.Int(domain.ID), AttrNodeName.String(nodeName))
+	return &Zone{DomainID: domain.ID, DomainName: domain.DomainName, NodeName: nodeName}, nil
+}
+
+// rootLookupName returns the hostname to ask /dns/getroot about for fqdn.
+// Leading wildcard and underscore labels (e.g. _acme-challenge) are dropped
+// since they aren't valid hostnames.
+func rootLookupName(fqdn string) (string, error) {
+	name, err := normalizeName(fqdn)
+	if err != nil {
+		return "", err
+	}
+	labels := strings.Split(name, ".")
+	for len(labels) > 0 && (labels[0] == "*" || strings.HasPrefix(labels[0], "_")) {
+		labels = labels[1:]
+	}
+	if len(labels) == 0 {
+		return "", fmt.Errorf("%q has no hostname to look up a Dynu domain for", fqdn)
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// SplitFQDN returns the node name of fqdn within domainName, i.e. the part
+// in front of the domain, or "" when fqdn is the domain apex. Both names are
+// compared case-insensitively and may carry a trailing dot; the node name is
+// returned in lower case. On success nodeName + "." + domainName (or just
+// domainName at the apex) equals fqdn without its trailing dot.
+func SplitFQDN(fqdn, domainName string) (nodeName string, err error) {
+	name, err := normalizeName(fqdn)
+	if err != nil {
+		return "", err
+	}
+	domain, err := normalizeName(domainName)
+	if err != nil {
+		return "", fmt.Errorf("invalid domain: %v", err)
+	}
+	if name == domain {
+		return "", nil
+	}
+	// match whole labels only, so a domain that also appears earlier in the
+	// name (example.com.example.com) is stripped just once from the end
+	if !strings.HasSuffix(name, "."+domain) {
+		return "", fmt.Errorf("%q is not within domain %q", fqdn, domainName)
+	}
+	return strings.TrimSuffix(name, "."+domain), nil
+}
+
+// normalizeName lower-cases a DNS name, strips its trailing dot and checks
+// that it is made of non-empty labels within the DNS length limits
+func normalizeName(name string) (string, error) {
+	n := strings.ToLower(strings.TrimSuffix(name, "."))
+	if n == "" {
+		return "", fmt.Errorf("empty DNS name %q", name)
+	}
+	if len(n) > 253 {
+		return "", fmt.Errorf("DNS name %q is longer than 253 characters", name)
+	}
+	for _, label := range strings.Split(n, ".") {
+		if label == "" {
+			return "", fmt.Errorf("DNS name %q has an empty label", name)
+		}
+		if len(label) > 63 {
+			return "", fmt.Errorf("DNS name %q has a label longer than 63 characters", name)
+		}
+		if strings.ContainsAny(label, " \t\r\n") {
+			return "", fmt.Errorf("DNS name %q contains whitespace", name)
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,60 @@
+//go:build go1.18
+// +build go1.18
+
+package dynuclient
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzSplitFQDN(f *testing.F) {
+	f.Add("_acme-challenge.example.com.", "example.com")
+	f.Add("_acme-challenge.a.b.example.com.", "example.com.")
+	f.Add("Example.COM.", "example.com")
+	f.Add("example.com.example.com", "example.com")
+	f.Add("*.example.com", "EXAMPLE.COM")
+	f.Add("a..example.com", "example.com")
+	f.Add("", "")
+	f.Add(".", ".")
+	f.Fuzz(func(t *testing.T, fqdn, domain string) {
+		node, err := SplitFQDN(fqdn, domain)
+		if err != nil {
+			return
+		}
+		name := strings.ToLower(strings.TrimSuffix(fqdn, "."))
+		zone := strings.ToLower(strings.TrimSuffix(domain, "."))
+		if node == "" {
+			if name != zone {
+				t.Fatalf("SplitFQDN(%q, %q) returned the apex for a different name", fqdn, domain)
+			}
+			return
+		}
+		if node+"."+zone != name {
+			t.Fatalf("SplitFQDN(%q, %q) = %q, which doesn't rebuild the FQDN", fqdn, domain, node)
+		}
+		if strings.HasPrefix(node, ".") || strings.HasSuffix(node, ".") || strings.Contains(node, "..") {
+			t.Fatalf("SplitFQDN(%q, %q) = %q, which has an empty label", fqdn, domain, node)
+		}
+	})
+}
+
+func FuzzRootLookupName(f *testing.F) {
+	f.Add("_acme-challenge.example.com.")
+	f.Add("*.example.com")
+	f.Add("_acme-challenge.")
+	f.Add("")
+	f.Fuzz(func(t *testing.T, fqdn string) {
+		host, err := rootLookupName(fqdn)
+		if err != nil {
+			return
+		}
+		name := strings.ToLower(strings.TrimSuffix(fqdn, "."))
+		if host != name && !strings.HasSuffix(name, "."+host) {
+			t.Fatalf("rootLookupName(%q) = %q, which isn't a suffix of the name", fqdn, host)
+		}
+		if strings.HasPrefix(host, "_") || strings.HasPrefix(host, "*.") {
+			t.Fatalf("rootLookupName(%q) = %q, which still starts with a non-hostname label", fqdn, host)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package dynuclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveZone(t *testing.T) {
+	// the account holds example.com and a delegated sub.example.org
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := strings.TrimPrefix(req.URL.Path, "/dns/getroot/")
+		switch {
+		case host == "example.com" || strings.HasSuffix(host, ".example.com"):
+			w.Write([]byte(fmt.Sprintf(`{"statusCode": 200,"id": 1,"domainName": "example.com","hostname": %q}`, host)))
+		case host == "sub.example.org" || strings.HasSuffix(host, ".sub.example.org"):
+			w.Write([]byte(fmt.Sprintf(`{"statusCode": 200,"id": 2,"domainName": "sub.example.org","hostname": %q}`, host)))
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte(`{"statusCode":501,"type":"Argument Exception","message":"Invalid hostname."}`))
+		}
+	}))
+	defer srv.Close()
+	dynu := newRetryTestClient(srv.URL)
+
+	tests := []struct {
+		fqdn string
+		zone Zone
+	}{
+		{"_acme-challenge.example.com.", Zone{DomainID: 1, DomainName: "example.com", NodeName: "_acme-challenge"}},
+		{"_acme-challenge.www.example.com.", Zone{DomainID: 1, DomainName: "example.com", NodeName: "_acme-challenge.www"}},
+		{"_acme-challenge.a.b.example.com.", Zone{DomainID: 1, DomainName: "example.com", NodeName: "_acme-challenge.a.b"}},
+		{"_ACME-Challenge.WWW.Example.COM.", Zone{DomainID: 1, DomainName: "example.com", NodeName: "_acme-challenge.www"}},
+		{"*.example.com", Zone{DomainID: 1, DomainName: "example.com", NodeName: "*"}},
+		{"example.com.", Zone{DomainID: 1, DomainName: "example.com", NodeName: ""}},
+		{"_acme-challenge.host.sub.example.org.", Zone{DomainID: 2, DomainName: "sub.example.org", NodeName: "_acme-challenge.host"}},
+	}
+	for _, tt := range tests {
+		zone, err := dynu.ResolveZone(context.Background(), tt.fqdn)
+		if assert.NoError(t, err, tt.fqdn) {
+			assert.Equal(t, tt.zone, *zone, tt.fqdn)
+		}
+	}
+
+	_, err := dynu.ResolveZone(context.Background(), "_acme-challenge.unknown.net.")
+	assert.Error(t, err)
+	_, err = dynu.ResolveZone(context.Background(), "_acme-challenge.")
+	assert.Error(t, err)
+}
+
+func TestSplitFQDN(t *testing.T) {
+	tests := []struct {
+		fqdn, domain string
+		node         string
+		valid        bool
+	}{
+		{"_acme-challenge.example.com.", "example.com", "_acme-challenge", true},
+		{"_acme-challenge.example.com", "example.com.", "_acme-challenge", true},
+		{"_acme-challenge.a.b.example.com.", "example.com", "_acme-challenge.a.b", true},
+		{"_ACME-Challenge.WWW.Example.Com.", "EXAMPLE.com", "_acme-challenge.www", true},
+		{"example.com.", "example.com", "", true},
+		{"*.example.com", "example.com", "*", true},
+		{"_acme-challenge.example.com.example.com.", "example.com", "_acme-challenge.example.com", true},
+		{"example.com.example.com", "example.com", "example.com", true},
+		{"_acme-challenge.notexample.com.", "example.com", "", false},
+		{"_acme-challenge.example.com.", "www.example.com", "", false},
+		{"_acme-challenge.example.org.", "example.com", "", false},
+		{"com.", "example.com", "", false},
+		{"", "example.com", "", false},
+		{".", "example.com", "", false},
+		{"_acme-challenge.example.com.", "", "", false},
+		{"_acme-challenge..example.com.", "example.com", "", false},
+		{".example.com", "example.com", "", false},
+		{"example.com..", "example.com", "", false},
+		{"_acme challenge.example.com.", "example.com", "", false},
+		{strings.Repeat("a", 64) + ".example.com.", "example.com", "", false},
+		{strings.Repeat("a.", 127) + "example.com.", "example.com", "", false},
+	}
+	for _, tt := range tests {
+		node, err := SplitFQDN(tt.fqdn, tt.domain)
+		if !tt.valid {
+			assert.Error(t, err, "SplitFQDN(%q, %q) returned %q", tt.fqdn, tt.domain, node)
+			continue
+		}
+		if assert.NoError(t, err, "SplitFQDN(%q, %q)", tt.fqdn, tt.domain) {
+			assert.Equal(t, tt.node, node, "SplitFQDN(%q, %q)", tt.fqdn, tt.domain)
+		}
+	}
+}
+
+func TestRootLookupName(t *testing.T) {
+	tests := []struct {
+		fqdn, host string
+		valid      bool
+	}{
+		{"_acme-challenge.example.com.", "example.com", true},
+		{"_acme-challenge.www.Example.com.", "www.example.com", true},
+		{"_acme-challenge._tcp.a.b.example.com", "a.b.example.com", true},
+		{"*.example.com.", "example.com", true},
+		{"example.com", "example.com", true},
+		{"_acme-challenge.", "", false},
+		{"*._acme-challenge", "", false},
+		{"", "", false},
+		{"_acme-challenge..example.com.", "", false},
+	}
+	for _, tt := range tests {
+		host, err := rootLookupName(tt.fqdn)
+		if !tt.valid {
+			assert.Error(t, err, "rootLookupName(%q) returned %q", tt.fqdn, host)
+			continue
+		}
+		if assert.NoError(t, err, "rootLookupName(%q)", tt.fqdn) {
+			assert.Equal(t, tt.host, host, "rootLookupName(%q)", tt.fqdn)
+		}
+	}
+}
+
+// TestSplitFQDNInvariants checks that whatever SplitFQDN accepts rebuilds
+// the FQDN from non-empty labels, including for malformed input
+func TestSplitFQDNInvariants(t *testing.T) {
+	tests := []struct{ fqdn, domain string }{
+		{"_acme-challenge.example.com.", "example.com"},
+		{"_acme-challenge.a.b.example.com.", "example.com."},
+		{"Example.COM.", "example.com"},
+		{"example.com.example.com", "example.com"},
+		{"*.example.com", "EXAMPLE.COM"},
+		{"a..example.com", "example.com"},
+		{"..example.com", "example.com"},
+		{"a.example.com", ".example.com"},
+		{"a.example.com", "example.com.."},
+		{".a.example.com.", "a.example.com"},
+		{"example.com", "com"},
+		{"com", "com"},
+		{"", ""},
+		{".", "."},
+		{"..", "."},
+		{".", ""},
+	}
+	for _, tt := range tests {
+		node, err := SplitFQDN(tt.fqdn, tt.domain)
+		if err != nil {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(tt.fqdn, "."))
+		zone := strings.ToLower(strings.TrimSuffix(tt.domain, "."))
+		if node == "" {
+			assert.Equal(t, zone, name, "SplitFQDN(%q, %q) returned the apex for a different name", tt.fqdn, tt.domain)
+			continue
+		}
+		assert.Equal(t, name, node+"."+zone, "SplitFQDN(%q, %q) = %q, which doesn't rebuild the FQDN", tt.fqdn, tt.domain, node)
+		assert.False(t, strings.HasPrefix(node, ".") || strings.HasSuffix(node, ".") || strings.Contains(node, ".."),
+			"SplitFQDN(%q, %q) = %q, which has an empty label", tt.fqdn, tt.domain, node)
+	}
+}
+
+// TestRootLookupNameInvariants checks that whatever rootLookupName accepts
+// is a hostname suffix of the FQDN
+func TestRootLookupNameInvariants(t *testing.T) {
+	tests := []string{
+		"_acme-challenge.example.com.",
+		"*.example.com",
+		"_acme-challenge.",
+		"_a._b.example.com",
+		"*.*.example.com",
+		"_acme-challenge.*.example.com",
+		"*",
+		".",
+		"..",
+		"",
+	}
+	for _, fqdn := range tests {
+		host, err := rootLookupName(fqdn)
+		if err != nil {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(fqdn, "."))
+		assert.True(t, host == name || strings.HasSuffix(name, "."+host), "rootLookupName(%q) = %q, which isn't a suffix of the name", fqdn, host)
+		assert.False(t, strings.HasPrefix(host, "_") || strings.HasPrefix(host, "*."), "rootLookupName(%q) = %q, which still starts with a non-hostname label", fqdn, host)
+	}
+}
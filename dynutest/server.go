@@ -0,0 +1,634 @@
+// Package dynutest provides an in-memory fake of the Dynu v2 API for tests
+// that shouldn't need a Dynu account or network access.
+//
+// It deliberately doesn't import dynuclient, so dynuclient's own tests can
+// use it.
+package dynutest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NameServers are the name servers reported for every domain
+var NameServers = []string{"ns1.dynu.com", "ns2.dynu.com", "ns3.dynu.com"}
+
+// Domain is a root domain held by the fake account
+type Domain struct {
+	ID          int
+	Name        string
+	TTL         int
+	IPv4Address string
+	IPv6Address string
+	DNSSEC      bool
+	UpdatedOn   time.Time
+}
+
+// Record is a DNS record held by the fake account
+type Record struct {
+	ID         int
+	DomainID   int
+	DomainName string
+	NodeName   string
+	RecordType string
+	TextData   string
+	TTL        int
+	State      bool
+	UpdatedOn  time.Time
+
+	// type-specific fields, named as in the Dynu API
+	IPv4Address string
+	IPv6Address string
+	Host        string
+	Priority    int
+	Weight      int
+	Port        int
+	Flags       int
+	Tag         string
+	Value       string
+}
+
+// Hostname returns the record's fully qualified name without a trailing dot
+func (r Record) Hostname() string {
+	if r.NodeName == "" {
+		return r.DomainName
+	}
+	return r.NodeName + "." + r.DomainName
+}
+
+// Data returns the record's data as it appears in a zone file, e.g. the
+// address of an A record
+func (r Record) Data() string {
+	switch r.RecordType {
+	case "A":
+		return r.IPv4Address
+	case "AAAA":
+		return r.IPv6Address
+	case "CNAME":
+		return r.Host
+	case "MX":
+		return fmt.Sprintf("%d %s", r.Priority, r.Host)
+	case "SRV":
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Host)
+	case "CAA":
+		return fmt.Sprintf("%d %s %q", r.Flags, r.Tag, r.Value)
+	}
+	return fmt.Sprintf("%q", r.TextData)
+}
+
+// Server is a stateful fake Dynu API listening on a local port. Requests
+// must carry APIKey in the API-Key header, or a bearer token when OAuth2 is
+// enabled.
+type Server struct {
+	// URL is the API base URL to use as DynuClient.BaseURL or apiBaseURL,
+	// e.g. http://127.0.0.1:1234/v2
+	URL    string
+	APIKey string
+	// NoHostnameLookup makes /dns/record/{hostname} answer a plain-text 404,
+	// like an API without that endpoint
+	NoHostnameLookup bool
+
+	// ClientID and ClientSecret enable OAuth2: GET /v2/oauth2/token with
+	// them as basic auth issues bearer tokens valid for TokenTTL
+	ClientID     string
+	ClientSecret string
+	TokenTTL     time.Duration
+
+	srv *httptest.Server
+
+	lock     sync.Mutex
+	nextID   int
+	domains  map[int]Domain
+	records  map[int]Record
+	requests []string
+	tokens   map[string]time.Time
+	issued   int
+}
+
+// NewServer starts a fake Dynu API accepting apiKey and seeded with domains
+func NewServer(apiKey string, domains ...string) *Server {
+	s := &Server{
+		APIKey:  apiKey,
+		nextID:  1000,
+		domains: map[int]Domain{},
+		records: map[int]Record{},
+		tokens:  map[string]time.Time{},
+	}
+	for _, d := range domains {
+		s.AddDomain(d)
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL + "/v2"
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// AddDomain seeds a root domain and returns its ID
+func (s *Server) AddDomain(name string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	id := s.newID()
+	s.domains[id] = Domain{ID: id, Name: normalize(name), TTL: 300, UpdatedOn: time.Now()}
+	return id
+}
+
+// RemoveDomain deletes a domain and its records, as if it was removed from
+// the account behind the webhook's back
+func (s *Server) RemoveDomain(id int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.domains, id)
+	for rid, r := range s.records {
+		if r.DomainID == id {
+			delete(s.records, rid)
+		}
+	}
+}
+
+// Domains returns a snapshot of all domains, ordered by ID
+func (s *Server) Domains() []Domain {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	domains := make([]Domain, 0, len(s.domains))
+	for _, d := range s.domains {
+		domains = append(domains, d)
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].ID < domains[j].ID })
+	return domains
+}
+
+// AddRecord seeds a record into the domain with the given ID and returns the
+// record's ID
+func (s *Server) AddRecord(rec Record) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rec.ID = s.newID()
+	rec.DomainName = s.domains[rec.DomainID].Name
+	if rec.UpdatedOn.IsZero() {
+		rec.UpdatedOn = time.Now()
+	}
+	s.records[rec.ID] = rec
+	return rec.ID
+}
+
+// Records returns a snapshot of all records, ordered by ID
+func (s *Server) Records() []Record {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	recs := make([]Record, 0, len(s.records))
+	for _, r := range s.records {
+		recs = append(recs, r)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].ID < recs[j].ID })
+	return recs
+}
+
+// TXT returns the text of every enabled TXT record for fqdn
+func (s *Server) TXT(fqdn string) []string {
+	name := normalize(fqdn)
+	var txt []string
+	for _, r := range s.Records() {
+		if r.RecordType == "TXT" && r.State && r.Hostname() == name {
+			txt = append(txt, r.TextData)
+		}
+	}
+	return txt
+}
+
+// ExpireTokens revokes every OAuth2 token issued so far
+func (s *Server) ExpireTokens() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tokens = map[string]time.Time{}
+}
+
+// Requests returns "METHOD /path" for every request received so far
+func (s *Server) Requests() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+// domainFor returns the longest seeded domain that hostname is within
+func (s *Server) domainFor(hostname string) (Domain, bool) {
+	name := normalize(hostname)
+	var best Domain
+	found := false
+	for _, d := range s.domains {
+		if (name == d.Name || strings.HasSuffix(name, "."+d.Name)) && len(d.Name) > len(best.Name) {
+			best, found = d, true
+		}
+	}
+	return best, found
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = append(s.requests, req.Method+" "+req.URL.Path)
+
+	if req.URL.Path == "/v2/oauth2/token" {
+		s.issueToken(w, req)
+		return
+	}
+	if !s.authorized(req) {
+		writeError(w, http.StatusUnauthorized, "Authentication Exception", "Invalid API credentials.")
+		return
+	}
+
+	path := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/v2"), "/"), "/")
+	switch {
+	case len(path) == 1 && path[0] == "dns" && req.Method == http.MethodGet:
+		s.listDomains(w)
+	case len(path) == 2 && path[0] == "dns" && path[1] != "getroot":
+		domain, ok := s.domainByID(w, path[1])
+		if !ok {
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+			resp := domainJSON(domain)
+			resp["statusCode"] = 200
+			writeJSON(w, resp)
+		case http.MethodPost:
+			s.updateDomain(w, req, domain)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Argument Exception", "Method not allowed.")
+		}
+	case len(path) == 3 && path[0] == "dns" && path[1] == "record" && req.Method == http.MethodGet:
+		if s.NoHostnameLookup {
+			http.NotFound(w, req)
+			return
+		}
+		s.hostnameRecords(w, path[2], req.URL.Query().Get("recordType"))
+	case len(path) == 3 && path[0] == "dns" && path[1] == "getroot" && req.Method == http.MethodGet:
+		s.getRoot(w, path[2])
+	case len(path) == 3 && path[0] == "dns" && path[2] == "record":
+		domain, ok := s.domainByID(w, path[1])
+		if !ok {
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+			s.listRecords(w, domain)
+		case http.MethodPost:
+			s.createRecord(w, req, domain)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Argument Exception", "Method not allowed.")
+		}
+	case len(path) == 4 && path[0] == "dns" && path[2] == "record":
+		domain, ok := s.domainByID(w, path[1])
+		if !ok {
+			return
+		}
+		rec, ok := s.recordByID(w, domain, path[3])
+		if !ok {
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+			resp := recordJSON(rec)
+			resp["statusCode"] = 200
+			writeJSON(w, resp)
+		case http.MethodPost:
+			s.updateRecord(w, req, rec)
+		case http.MethodDelete:
+			delete(s.records, rec.ID)
+			writeJSON(w, map[string]interface{}{"statusCode": 200})
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Argument Exception", "Method not allowed.")
+		}
+	default:
+		writeError(w, http.StatusNotFound, "Not Found Exception", fmt.Sprintf("No endpoint %s %s.", req.Method, req.URL.Path))
+	}
+}
+
+// authorized checks the API key or bearer token of req
+func (s *Server) authorized(req *http.Request) bool {
+	if key := req.Header.Get("API-Key"); key != "" {
+		return key == s.APIKey
+	}
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	expires, ok := s.tokens[token]
+	return ok && time.Now().Before(expires)
+}
+
+func (s *Server) issueToken(w http.ResponseWriter, req *http.Request) {
+	id, secret, ok := req.BasicAuth()
+	if s.ClientID == "" || !ok || id != s.ClientID || secret != s.ClientSecret {
+		writeError(w, http.StatusUnauthorized, "Authentication Exception", "Invalid client credentials.")
+		return
+	}
+	ttl := s.TokenTTL
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+	s.issued++
+	token := fmt.Sprintf("token-%d", s.issued)
+	s.tokens[token] = time.Now().Add(ttl)
+	writeJSON(w, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   int(ttl / time.Second),
+	})
+}
+
+func (s *Server) listDomains(w http.ResponseWriter) {
+	domains := []map[string]interface{}{}
+	ids := make([]int, 0, len(s.domains))
+	for id := range s.domains {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		domains = append(domains, domainJSON(s.domains[id]))
+	}
+	writeJSON(w, map[string]interface{}{"statusCode": 200, "domains": domains})
+}
+
+// domainRequest is the body of a domain update
+type domainRequest struct {
+	Name        string `json:"name"`
+	TTL         int    `json:"ttl"`
+	IPv4Address string `json:"ipv4Address"`
+	IPv6Address string `json:"ipv6Address"`
+	DNSSEC      bool   `json:"dnssec"`
+}
+
+func (s *Server) updateDomain(w http.ResponseWriter, req *http.Request, d Domain) {
+	var body domainRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusNotImplemented, "Argument Exception", "Invalid request body.")
+		return
+	}
+	if normalize(body.Name) != d.Name {
+		writeError(w, http.StatusNotImplemented, "Validation Exception", "Domain name can't be changed.")
+		return
+	}
+	if body.TTL < 0 {
+		writeError(w, http.StatusNotImplemented, "Validation Exception", "TTL is invalid.")
+		return
+	}
+	if body.TTL > 0 {
+		d.TTL = body.TTL
+	}
+	d.IPv4Address, d.IPv6Address, d.DNSSEC = body.IPv4Address, body.IPv6Address, body.DNSSEC
+	d.UpdatedOn = time.Now()
+	s.domains[d.ID] = d
+	writeJSON(w, map[string]interface{}{"statusCode": 200})
+}
+
+func domainJSON(d Domain) map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":          d.ID,
+		"name":        d.Name,
+		"unicodeName": d.Name,
+		"state":       "Complete",
+		"ttl":         d.TTL,
+		"ipv4":        d.IPv4Address != "",
+		"ipv6":        d.IPv6Address != "",
+		"dnssec":      d.DNSSEC,
+		"nameServers": NameServers,
+		"updatedOn":   d.UpdatedOn.UTC().Format("2006-01-02T15:04:05"),
+	}
+	if d.IPv4Address != "" {
+		resp["ipv4Address"] = d.IPv4Address
+	}
+	if d.IPv6Address != "" {
+		resp["ipv6Address"] = d.IPv6Address
+	}
+	return resp
+}
+
+func (s *Server) getRoot(w http.ResponseWriter, hostname string) {
+	d, ok := s.domainFor(hostname)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "Argument Exception", "Invalid hostname.")
+		return
+	}
+	name := normalize(hostname)
+	node := strings.TrimSuffix(strings.TrimSuffix(name, d.Name), ".")
+	writeJSON(w, map[string]interface{}{
+		"statusCode": 200,
+		"id":         d.ID,
+		"domainName": d.Name,
+		"hostname":   name,
+		"node":       node,
+	})
+}
+
+func (s *Server) domainByID(w http.ResponseWriter, id string) (Domain, bool) {
+	domainID, err := strconv.Atoi(id)
+	if err != nil {
+		writeError(w, http.StatusNotImplemented, "Argument Exception", "Invalid domain ID.")
+		return Domain{}, false
+	}
+	d, ok := s.domains[domainID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found Exception", "Domain not found.")
+		return Domain{}, false
+	}
+	return d, true
+}
+
+func (s *Server) listRecords(w http.ResponseWriter, d Domain) {
+	recs := []map[string]interface{}{}
+	for _, r := range s.records {
+		if r.DomainID == d.ID {
+			recs = append(recs, recordJSON(r))
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i]["id"].(int) < recs[j]["id"].(int) })
+	writeJSON(w, map[string]interface{}{"statusCode": 200, "dnsRecords": recs})
+}
+
+func (s *Server) hostnameRecords(w http.ResponseWriter, hostname, recordType string) {
+	if _, ok := s.domainFor(hostname); !ok {
+		writeError(w, http.StatusNotImplemented, "Argument Exception", "Invalid hostname.")
+		return
+	}
+	name := normalize(hostname)
+	recs := []map[string]interface{}{}
+	for _, r := range s.records {
+		if r.Hostname() == name && (recordType == "" || strings.EqualFold(r.RecordType, recordType)) {
+			recs = append(recs, recordJSON(r))
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i]["id"].(int) < recs[j]["id"].(int) })
+	writeJSON(w, map[string]interface{}{"statusCode": 200, "dnsRecords": recs})
+}
+
+// recordRequest is the body of a create or update request. Dynu accepts the
+// TTL as either a number or a string.
+type recordRequest struct {
+	NodeName    string          `json:"nodeName"`
+	RecordType  string          `json:"recordType"`
+	TextData    string          `json:"textData"`
+	TTL         json.RawMessage `json:"ttl"`
+	State       *bool           `json:"state"`
+	IPv4Address string          `json:"ipv4Address"`
+	IPv6Address string          `json:"ipv6Address"`
+	Host        string          `json:"host"`
+	Priority    int             `json:"priority"`
+	Weight      int             `json:"weight"`
+	Port        int             `json:"port"`
+	Flags       int             `json:"flags"`
+	Tag         string          `json:"tag"`
+	Value       string          `json:"value"`
+}
+
+// decodeRecord validates a create or update request and applies it to rec
+func decodeRecord(w http.ResponseWriter, req *http.Request, rec *Record) bool {
+	var body recordRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusNotImplemented, "Argument Exception", "Invalid request body.")
+		return false
+	}
+	rec.RecordType = strings.ToUpper(body.RecordType)
+	if msg := validateRecord(rec.RecordType, body); msg != "" {
+		writeError(w, http.StatusNotImplemented, "Validation Exception", msg)
+		return false
+	}
+	rec.TTL = 300
+	if len(body.TTL) > 0 {
+		v, err := strconv.Atoi(strings.Trim(string(body.TTL), `"`))
+		if err != nil {
+			writeError(w, http.StatusNotImplemented, "Validation Exception", "TTL is invalid.")
+			return false
+		}
+		rec.TTL = v
+	}
+	rec.NodeName = strings.ToLower(body.NodeName)
+	rec.State = body.State == nil || *body.State
+	rec.TextData = body.TextData
+	rec.IPv4Address, rec.IPv6Address = body.IPv4Address, body.IPv6Address
+	rec.Host, rec.Priority, rec.Weight, rec.Port = body.Host, body.Priority, body.Weight, body.Port
+	rec.Flags, rec.Tag, rec.Value = body.Flags, body.Tag, body.Value
+	rec.UpdatedOn = time.Now()
+	return true
+}
+
+// validateRecord returns the message Dynu would reject body with, or ""
+func validateRecord(recordType string, body recordRequest) string {
+	switch recordType {
+	case "":
+		return "Record type is required."
+	case "A":
+		if ip := net.ParseIP(body.IPv4Address); ip == nil || ip.To4() == nil {
+			return "IPv4 address is invalid."
+		}
+	case "AAAA":
+		if ip := net.ParseIP(body.IPv6Address); ip == nil || ip.To4() != nil {
+			return "IPv6 address is invalid."
+		}
+	case "CNAME", "MX", "SRV":
+		if body.Host == "" {
+			return "Host is required."
+		}
+	case "CAA":
+		if body.Tag == "" || body.Value == "" {
+			return "Tag and value are required."
+		}
+	}
+	return ""
+}
+
+func (s *Server) createRecord(w http.ResponseWriter, req *http.Request, d Domain) {
+	rec := Record{DomainID: d.ID, DomainName: d.Name}
+	if !decodeRecord(w, req, &rec) {
+		return
+	}
+	rec.ID = s.newID()
+	s.records[rec.ID] = rec
+	resp := recordJSON(rec)
+	resp["statusCode"] = 200
+	writeJSON(w, resp)
+}
+
+func (s *Server) updateRecord(w http.ResponseWriter, req *http.Request, rec Record) {
+	if !decodeRecord(w, req, &rec) {
+		return
+	}
+	s.records[rec.ID] = rec
+	resp := recordJSON(rec)
+	resp["statusCode"] = 200
+	writeJSON(w, resp)
+}
+
+func (s *Server) recordByID(w http.ResponseWriter, d Domain, id string) (Record, bool) {
+	recordID, err := strconv.Atoi(id)
+	if err != nil {
+		writeError(w, http.StatusNotImplemented, "Argument Exception", "Invalid DNS record ID.")
+		return Record{}, false
+	}
+	rec, ok := s.records[recordID]
+	if !ok || rec.DomainID != d.ID {
+		writeError(w, http.StatusNotImplemented, "Argument Exception", "Unable to find DNS record.")
+		return Record{}, false
+	}
+	return rec, true
+}
+
+func recordJSON(r Record) map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":         r.ID,
+		"domainId":   r.DomainID,
+		"domainName": r.DomainName,
+		"nodeName":   r.NodeName,
+		"hostname":   r.Hostname(),
+		"recordType": r.RecordType,
+		"ttl":        r.TTL,
+		"state":      r.State,
+		"content":    fmt.Sprintf("%s %d IN %s %s", r.Hostname(), r.TTL, r.RecordType, r.Data()),
+		"updatedOn":  r.UpdatedOn.UTC().Format("2006-01-02T15:04:05"),
+	}
+	switch r.RecordType {
+	case "A":
+		resp["ipv4Address"] = r.IPv4Address
+	case "AAAA":
+		resp["ipv6Address"] = r.IPv6Address
+	case "CNAME":
+		resp["host"] = r.Host
+	case "MX":
+		resp["host"], resp["priority"] = r.Host, r.Priority
+	case "SRV":
+		resp["host"], resp["priority"], resp["weight"], resp["port"] = r.Host, r.Priority, r.Weight, r.Port
+	case "CAA":
+		resp["flags"], resp["tag"], resp["value"] = r.Flags, r.Tag, r.Value
+	default:
+		resp["textData"] = r.TextData
+	}
+	return resp
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, typ, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"statusCode": status, "type": typ, "message": message})
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
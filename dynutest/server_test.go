@@ -0,0 +1,55 @@
+package dynutest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func get(t *testing.T, s *Server, path, apiKey string) (int, map[string]interface{}) {
+	req, _ := http.NewRequest(http.MethodGet, s.URL+path, nil)
+	req.Header.Set("API-Key", apiKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := map[string]interface{}{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer("key", "example.com", "sub.example.com")
+	defer s.Close()
+
+	status, body := get(t, s, "/dns/getroot/_acme-challenge.a.sub.example.com", "key")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "sub.example.com", body["domainName"])
+	assert.Equal(t, "_acme-challenge.a", body["node"])
+
+	status, body = get(t, s, "/dns/getroot/example.org", "key")
+	assert.Equal(t, http.StatusNotImplemented, status)
+	assert.Equal(t, "Argument Exception", body["type"])
+
+	status, body = get(t, s, "/dns", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "Authentication Exception", body["type"])
+
+	status, body = get(t, s, "/dns", "key")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, body["domains"], 2)
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL+"/dns/1001/record", strings.NewReader(`{"nodeName":"TXT","recordType":"txt","textData":"abc","ttl":"60","state":true}`))
+	req.Header.Set("API-Key", "key")
+	resp, err := http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, []string{"abc"}, s.TXT("txt.example.com."))
+	assert.Equal(t, "POST /v2/dns/1001/record", s.Requests()[len(s.Requests())-1])
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynuclient"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	cmacme "github.com/jetstack/cert-manager/pkg/apis/acme/v1"
+	cmclient "github.com/jetstack/cert-manager/pkg/client/clientset/versioned"
+	cmscheme "github.com/jetstack/cert-manager/pkg/client/clientset/versioned/scheme"
+	cminformers "github.com/jetstack/cert-manager/pkg/client/informers/externalversions"
+	logf "github.com/jetstack/cert-manager/pkg/logs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// eventComponent is the source of the Events the webhook records
+const eventComponent = "cert-manager-webhook-dynu"
+
+// Reasons of the Events recorded on Challenges
+const (
+	reasonRecordCreated = "RecordCreated"
+	reasonRecordExists  = "RecordExists"
+	reasonRecordRemoved = "RecordRemoved"
+	reasonRecordGone    = "RecordGone"
+	reasonDynuRetry     = "DynuRetry"
+	reasonDynuRateLimit = "DynuRateLimited"
+	reasonPresentFailed = "PresentFailed"
+	reasonCleanUpFailed = "CleanUpFailed"
+)
+
+// challengeIndex indexes Challenges by namespace, DNS name and key
+const challengeIndex = "dnsNameKey"
+
+// challengeEvents records Kubernetes Events on the Challenge resources the
+// webhook solves, so `kubectl describe challenge` shows what happened in
+// Dynu. A ChallengeRequest doesn't name its Challenge, so it is found by its
+// key and DNS name among the Challenges in the request's resource namespace,
+// where the Challenges of Issuers live. Challenges elsewhere, like those of
+// ClusterIssuers, get no Events. Challenges are served from a shared
+// informer indexed on those fields, and the Challenge found for a request is
+// remembered until it's deleted, so Present and CleanUp share one lookup. A
+// nil challengeEvents records nothing.
+type challengeEvents struct {
+	recorder record.EventRecorder
+	indexer  cache.Indexer
+	synced   cache.InformerSynced
+
+	lock  sync.Mutex
+	found map[string]*cmacme.Challenge
+}
+
+// newChallengeEvents starts an informer on the Challenges in all namespaces,
+// which runs until stopCh is closed
+func newChallengeEvents(client cmclient.Interface, recorder record.EventRecorder, stopCh <-chan struct{}) *challengeEvents {
+	factory := cminformers.NewSharedInformerFactory(client, 0)
+	informer := factory.Acme().V1().Challenges().Informer()
+	informer.AddIndexers(cache.Indexers{challengeIndex: func(obj interface{}) ([]string, error) {
+		challenge := obj.(*cmacme.Challenge)
+		return []string{challengeIndexKey(challenge.Namespace, challenge.Spec.DNSName, challenge.Spec.Key)}, nil
+	}})
+	e := &challengeEvents{recorder: recorder, indexer: informer.GetIndexer(), synced: informer.HasSynced, found: map[string]*cmacme.Challenge{}}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{DeleteFunc: e.forget})
+	factory.Start(stopCh)
+	return e
+}
+
+func challengeIndexKey(namespace, dnsName, key string) string {
+	return namespace + "/" + dnsName + "/" + key
+}
+
+// newEventRecorder returns a recorder sending Events to the API server until
+// stopCh is closed
+func newEventRecorder(client kubernetes.Interface, stopCh <-chan struct{}) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	go func() {
+		<-stopCh
+		broadcaster.Shutdown()
+	}()
+	return broadcaster.NewRecorder(cmscheme.Scheme, corev1.EventSource{Component: eventComponent})
+}
+
+// For finds the Challenge of ch and returns a recorder for its Events; call
+// it once per Present or CleanUp rather than for every Event. Failing to find
+// the Challenge, e.g. before the informer has synced, is logged, since the
+// Events are only informational, and yields a nil recorder.
+func (e *challengeEvents) For(ch *v1alpha1.ChallengeRequest) *challengeRecorder {
+	if e == nil {
+		return nil
+	}
+	challenge, err := e.challenge(ch)
+	if err != nil {
+		challengeLogger(ch).V(logf.DebugLevel).Info("not recording events", "error", err.Error())
+		return nil
+	}
+	return &challengeRecorder{recorder: e.recorder, challenge: challenge, zone: strings.TrimSuffix(ch.ResolvedZone, ".")}
+}
+
+// challenge finds the Challenge of ch
+func (e *challengeEvents) challenge(ch *v1alpha1.ChallengeRequest) (*cmacme.Challenge, error) {
+	key := challengeIndexKey(resourceNamespace(ch), ch.DNSName, ch.Key)
+	e.lock.Lock()
+	challenge, ok := e.found[key]
+	e.lock.Unlock()
+	if ok {
+		return challenge, nil
+	}
+	if !e.synced() {
+		return nil, fmt.Errorf("challenge informer hasn't synced yet")
+	}
+	objs, err := e.indexer.ByIndex(challengeIndex, key)
+	if err != nil {
+		return nil, fmt.Errorf("looking up challenges: %v", err)
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("no challenge for %s in namespace %q", ch.DNSName, resourceNamespace(ch))
+	}
+	challenge = objs[0].(*cmacme.Challenge)
+	e.lock.Lock()
+	e.found[key] = challenge
+	e.lock.Unlock()
+	return challenge, nil
+}
+
+// forget drops a deleted Challenge from the ones remembered
+func (e *challengeEvents) forget(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	challenge, ok := obj.(*cmacme.Challenge)
+	if !ok {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delete(e.found, challengeIndexKey(challenge.Namespace, challenge.Spec.DNSName, challenge.Spec.Key))
+}
+
+// challengeRecorder records Events on one Challenge. A nil challengeRecorder
+// records nothing.
+type challengeRecorder struct {
+	recorder  record.EventRecorder
+	challenge *cmacme.Challenge
+	// zone names the Dynu domain in messages when an event doesn't
+	zone string
+}
+
+// Eventf records an Event on the Challenge
+func (r *challengeRecorder) Eventf(eventType, reason, messageFmt string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	r.recorder.Eventf(r.challenge, eventType, reason, messageFmt, args...)
+}
+
+// dynuEvents returns a DynuClient.OnEvent that records the client's events
+// on the Challenge
+func (r *challengeRecorder) dynuEvents() func(dynuclient.Event) {
+	if r == nil {
+		return nil
+	}
+	return func(ev dynuclient.Event) {
+		domain := ev.DomainName
+		if domain == "" {
+			domain = r.zone
+		}
+		switch ev.Kind {
+		case dynuclient.EventRecordCreated:
+			r.Eventf(corev1.EventTypeNormal, reasonRecordCreated, "TXT record created in Dynu domain %s (id %d)", domain, ev.RecordID)
+		case dynuclient.EventRecordExists:
+			r.Eventf(corev1.EventTypeNormal, reasonRecordExists, "TXT record already present in Dynu domain %s (id %d)", domain, ev.RecordID)
+		case dynuclient.EventRecordDeleted:
+			r.Eventf(corev1.EventTypeNormal, reasonRecordRemoved, "Cleanup removed TXT record %d from Dynu domain %s", ev.RecordID, domain)
+		case dynuclient.EventRecordGone:
+			r.Eventf(corev1.EventTypeNormal, reasonRecordGone, "TXT record was already removed from Dynu domain %s", domain)
+		case dynuclient.EventRetry:
+			if ev.RateLimited {
+				r.Eventf(corev1.EventTypeWarning, reasonDynuRateLimit, "Dynu rate-limited %s %s, retrying in %v (attempt %d/%d)", ev.Method, ev.Endpoint, ev.Delay, ev.Attempt, ev.MaxAttempts)
+			} else {
+				r.Eventf(corev1.EventTypeWarning, reasonDynuRetry, "Dynu %s %s failed with %s, retrying in %v (attempt %d/%d)", ev.Method, ev.Endpoint, ev.Reason, ev.Delay, ev.Attempt, ev.MaxAttempts)
+			}
+		}
+	}
+}
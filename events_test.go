@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	cmacme "github.com/jetstack/cert-manager/pkg/apis/acme/v1"
+	cmfake "github.com/jetstack/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// recordedEvents drains the events a FakeRecorder has received so far
+func recordedEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestChallengeEvents(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+
+	challenge := func(name, key string) *cmacme.Challenge {
+		return &cmacme.Challenge{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps"},
+			Spec:       cmacme.ChallengeSpec{DNSName: "www.example.com", Key: key},
+		}
+	}
+	// a renewal's Challenge for the same name sits next to the one solved
+	client := cmfake.NewSimpleClientset(challenge("www-1234", "123d=="), challenge("www-5678", "other=="))
+	recorder := record.NewFakeRecorder(100)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	tracked := newChallengeEvents(client, recorder, stopCh)
+	assert.True(t, cache.WaitForCacheSync(stopCh, tracked.synced))
+	solver := &dynuProviderSolver{challenges: newChallengeStore(nil), events: tracked, limiter: unlimited}
+	ch := &v1alpha1.ChallengeRequest{
+		UID:               "request-uid",
+		DNSName:           "www.example.com",
+		ResourceNamespace: "apps",
+		ResolvedFQDN:      "_acme-challenge.www.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "123d==",
+		Config:            &extapi.JSON{Raw: []byte(fmt.Sprintf(`{"apiKey": %q, "apiBaseURL": %q}`, api.APIKey, api.URL))},
+	}
+
+	assert.NoError(t, solver.Present(ch))
+	assert.NoError(t, solver.Present(ch))
+	recordID := api.Records()[0].ID
+	assert.NoError(t, solver.CleanUp(ch))
+	assert.Equal(t, []string{
+		fmt.Sprintf("Normal RecordCreated TXT record created in Dynu domain example.com (id %d)", recordID),
+		fmt.Sprintf("Normal RecordExists TXT record already present in Dynu domain example.com (id %d)", recordID),
+		fmt.Sprintf("Normal RecordRemoved Cleanup removed TXT record %d from Dynu domain example.com", recordID),
+	}, recordedEvents(recorder))
+
+	lists := 0
+	for _, action := range client.Actions() {
+		assert.Contains(t, []string{"list", "watch"}, action.GetVerb(), "Challenges should only be read through the informer")
+		if action.GetVerb() == "list" {
+			lists++
+		}
+	}
+	assert.Equal(t, 1, lists, "Challenges should be listed once, by the informer")
+	tracked.lock.Lock()
+	assert.Len(t, tracked.found, 1, "Present and CleanUp should share the lookup")
+	tracked.lock.Unlock()
+
+	ch.Config = &extapi.JSON{Raw: []byte(fmt.Sprintf(`{"apiKey": "wrong", "apiBaseURL": %q}`, api.URL))}
+	assert.Error(t, solver.CleanUp(ch))
+	events := recordedEvents(recorder)
+	if assert.Len(t, events, 1) {
+		assert.True(t, strings.HasPrefix(events[0], "Warning CleanUpFailed "), events[0])
+	}
+
+	ch.Key = "unknown=="
+	assert.Error(t, solver.CleanUp(ch))
+	assert.Empty(t, recordedEvents(recorder), "events for unknown Challenges should be dropped")
+
+	assert.NoError(t, client.AcmeV1().Challenges("apps").Delete(context.Background(), "www-1234", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		tracked.lock.Lock()
+		defer tracked.lock.Unlock()
+		return len(tracked.found) == 0
+	}, 5*time.Second, 10*time.Millisecond, "deleted Challenges should be forgotten")
+
+	var disabled *challengeEvents
+	assert.Nil(t, disabled.For(ch))
+	var none *challengeRecorder
+	none.Eventf("Normal", reasonRecordCreated, "ignored")
+	assert.Nil(t, none.dynuEvents())
+}
@@ -6,10 +6,16 @@ require (
 	github.com/go-logr/logr v0.2.1
 	github.com/jetstack/cert-manager v1.0.4
 	github.com/miekg/dns v1.1.29
-	github.com/stretchr/testify v1.6.1
-	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68 // indirect
+	github.com/prometheus/client_golang v1.7.1
+	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.25.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
+	k8s.io/api v0.19.0
 	k8s.io/apiextensions-apiserver v0.19.0
 	k8s.io/apimachinery v0.19.0
 	k8s.io/client-go v0.19.0
-	k8s.io/klog v1.0.0
+	k8s.io/klog/v2 v2.3.0
 )
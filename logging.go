@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	logf "github.com/jetstack/cert-manager/pkg/logs"
+)
+
+// logger is the solver's logger. It writes through klog like the rest of
+// cert-manager's webhook, so -v sets its verbosity.
+var logger = logf.Log.WithName("dynu-solver")
+
+// challengeLogger returns the logger for messages about ch
+func challengeLogger(ch *v1alpha1.ChallengeRequest) logr.Logger {
+	return logger.WithValues("challenge", string(ch.UID), "dnsName", ch.DNSName, "resolvedFQDN", ch.ResolvedFQDN)
+}
@@ -1,33 +1,88 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	b64 "encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	// cmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
 	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
 	"github.com/jetstack/cert-manager/pkg/acme/webhook/cmd"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
 	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/klog"
 
 	// "github.com/jetstack/cert-manager/pkg/issuer/acme/dns/util"
 	"github.com/gstore/cert-manager-webhook-dynu/dynuclient"
 	certmgrv1 "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cmclient "github.com/jetstack/cert-manager/pkg/client/clientset/versioned"
+	logf "github.com/jetstack/cert-manager/pkg/logs"
 )
 
 var (
-	dnsRecordID int
 	// GroupName ...
 	GroupName = os.Getenv("GROUP_NAME")
+
+	// rateLimit and rateBurst size the token bucket shared by every Dynu
+	// client in the process, unless an issuer config overrides them.
+	rateLimit = envFloat("DYNU_RATE_LIMIT", dynuclient.DefaultRateLimit)
+	rateBurst = envInt("DYNU_RATE_BURST", dynuclient.DefaultRateBurst)
+
+	// domainCacheTTL and negativeDomainCacheTTL control how long the root
+	// domain of a hostname, or the lack of one, is remembered.
+	domainCacheTTL         = envDuration("DYNU_DOMAIN_CACHE_TTL", dynuclient.DefaultDomainCacheTTL)
+	negativeDomainCacheTTL = envDuration("DYNU_NEGATIVE_DOMAIN_CACHE_TTL", dynuclient.DefaultNegativeDomainCacheTTL)
+
+	// challengeStateConfigMap names the ConfigMap challenge records are
+	// persisted in; persistence is off when it's empty.
+	challengeStateConfigMap = os.Getenv("CHALLENGE_STATE_CONFIGMAP")
+	challengeStateNamespace = os.Getenv("POD_NAMESPACE")
+
+	// clusterResourceNamespace is where cert-manager keeps the resources of
+	// ClusterIssuers; credentials of challenges that don't name a namespace
+	// are read from it.
+	clusterResourceNamespace = envString("CLUSTER_RESOURCE_NAMESPACE", "cert-manager")
+	// allowedSecretNamespaces lists the namespaces a secret selector may
+	// point to with its namespace field, besides the challenge's own.
+	allowedSecretNamespaces = envStringList("ALLOWED_SECRET_NAMESPACES")
+
+	// secretCacheEnabled reads credential Secrets through informers instead
+	// of a GET per challenge.
+	secretCacheEnabled = envBool("SECRET_CACHE", true)
+	// secretCacheNamespaces lists the namespaces whose Secrets are watched,
+	// e.g. those of Issuers and the cluster resource namespace.
+	secretCacheNamespaces = envStringList("SECRET_CACHE_NAMESPACES")
+
+	// metricsListenAddress is where Prometheus metrics are served; they
+	// aren't served when it's empty.
+	metricsListenAddress = envString("METRICS_LISTEN_ADDRESS", "0.0.0.0:9402")
+
+	// dynuHTTPTimeout, dynuCAFile and the connection limits configure the
+	// HTTP client all Dynu API requests share, see httpClientConfig.
+	dynuHTTPTimeout     = envDuration("DYNU_HTTP_TIMEOUT", dynuclient.DefaultTimeout)
+	dynuCAFile          = os.Getenv("DYNU_CA_FILE")
+	dynuMaxIdleConns    = envInt("DYNU_MAX_IDLE_CONNS", 10)
+	dynuMaxConnsPerHost = envInt("DYNU_MAX_CONNS_PER_HOST", 0)
+	dynuIdleConnTimeout = envDuration("DYNU_IDLE_CONN_TIMEOUT", 90*time.Second)
+
+	// challengeEventsEnabled records Kubernetes Events on the Challenges the
+	// webhook solves.
+	challengeEventsEnabled = envBool("CHALLENGE_EVENTS", true)
+
+	// redactLogs masks API keys, OAuth2 tokens and challenge keys in log
+	// messages.
+	redactLogs = envBool("REDACT_LOGS", true)
 )
 
 func main() {
@@ -35,6 +90,26 @@ func main() {
 		panic("GROUP_NAME must be specified")
 	}
 
+	flag.Float64Var(&rateLimit, "dynu-rate-limit", rateLimit, "Sustained Dynu API requests per second (env DYNU_RATE_LIMIT)")
+	flag.IntVar(&rateBurst, "dynu-rate-burst", rateBurst, "Dynu API requests allowed in a burst (env DYNU_RATE_BURST)")
+	flag.DurationVar(&domainCacheTTL, "dynu-domain-cache-ttl", domainCacheTTL, "How long to cache the Dynu domain of a hostname; 0 disables the cache (env DYNU_DOMAIN_CACHE_TTL)")
+	flag.DurationVar(&negativeDomainCacheTTL, "dynu-negative-domain-cache-ttl", negativeDomainCacheTTL, "How long to cache that Dynu has no domain for a hostname; 0 disables negative caching (env DYNU_NEGATIVE_DOMAIN_CACHE_TTL)")
+	flag.StringVar(&challengeStateConfigMap, "challenge-state-configmap", challengeStateConfigMap, "ConfigMap to persist challenge records in so CleanUp survives restarts; disabled when empty (env CHALLENGE_STATE_CONFIGMAP)")
+	flag.StringVar(&challengeStateNamespace, "challenge-state-namespace", challengeStateNamespace, "Namespace of the challenge state ConfigMap (env POD_NAMESPACE)")
+
+	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", clusterResourceNamespace, "Namespace to read credentials from when a challenge names none; should match cert-manager's --cluster-resource-namespace (env CLUSTER_RESOURCE_NAMESPACE)")
+	flag.Var(&allowedSecretNamespaces, "allowed-secret-namespaces", "Comma-separated namespaces secret selectors may name explicitly (env ALLOWED_SECRET_NAMESPACES)")
+	flag.BoolVar(&secretCacheEnabled, "secret-cache", secretCacheEnabled, "Watch credential Secrets instead of fetching them for every challenge (env SECRET_CACHE)")
+	flag.Var(&secretCacheNamespaces, "secret-cache-namespaces", "Comma-separated namespaces whose Secrets the cache watches; needs list and watch on Secrets in them (env SECRET_CACHE_NAMESPACES)")
+	flag.StringVar(&metricsListenAddress, "metrics-listen-address", metricsListenAddress, "Address to serve Prometheus metrics on; disabled when empty (env METRICS_LISTEN_ADDRESS)")
+	flag.DurationVar(&dynuHTTPTimeout, "dynu-http-timeout", dynuHTTPTimeout, "Timeout of each Dynu API request (env DYNU_HTTP_TIMEOUT)")
+	flag.StringVar(&dynuCAFile, "dynu-ca-file", dynuCAFile, "PEM bundle of CAs to trust for the Dynu API besides the system ones, e.g. of a TLS-inspecting proxy (env DYNU_CA_FILE)")
+	flag.IntVar(&dynuMaxIdleConns, "dynu-max-idle-conns", dynuMaxIdleConns, "Idle connections to the Dynu API to keep open (env DYNU_MAX_IDLE_CONNS)")
+	flag.IntVar(&dynuMaxConnsPerHost, "dynu-max-conns-per-host", dynuMaxConnsPerHost, "Maximum connections to the Dynu API; 0 means no limit (env DYNU_MAX_CONNS_PER_HOST)")
+	flag.DurationVar(&dynuIdleConnTimeout, "dynu-idle-conn-timeout", dynuIdleConnTimeout, "How long idle connections to the Dynu API are kept open (env DYNU_IDLE_CONN_TIMEOUT)")
+	flag.BoolVar(&challengeEventsEnabled, "challenge-events", challengeEventsEnabled, "Record Events on the Challenges being solved; needs list and watch on challenges and create on events (env CHALLENGE_EVENTS)")
+	flag.BoolVar(&redactLogs, "redact-logs", redactLogs, "Mask API keys, tokens and challenge keys in logs; only turn off to debug with a test account (env REDACT_LOGS)")
+
 	// This will register our custom DNS provider with the webhook serving
 	// library, making it available as an API under the provided GroupName.
 	// You can register multiple DNS provider implementations with a single
@@ -56,8 +131,19 @@ type dynuProviderSolver struct {
 	// 3. uncomment the relevant code in the Initialize method below
 	// 4. ensure your webhook's service account has the required RBAC role
 	//    assigned to it for interacting with the Kubernetes APIs you need.
-	client     kubernetes.Clientset
+	client     kubernetes.Interface
 	httpClient *http.Client
+	// limiter throttles Dynu API requests; nil means dynuclient.DefaultLimiter
+	limiter dynuclient.Limiter
+	// ctx is cancelled once the stopCh passed to Initialize is closed, which
+	// aborts any in-flight Dynu API calls.
+	ctx context.Context
+	// challenges tracks the records created by Present for CleanUp
+	challenges *challengeStore
+	// secrets caches credential Secrets; nil means reading them directly
+	secrets *secretCache
+	// events records Events on Challenges; nil means no Events
+	events *challengeEvents
 }
 
 // dynuProviderConfig is a structure that is used to decode into when
@@ -82,9 +168,30 @@ type dynuProviderConfig struct {
 
 	//Email           string `json:"email"`
 	// APIKeySecretRef v1alpha1.SecretKeySelector `json:"apiKeySecretRef"`
-	APIKey             string                      `json:"apiKey"`
-	TTL                int                         `json:"ttl"`
-	APIKeySecretKeyRef certmgrv1.SecretKeySelector `json:"apikeySecretKeyRef"`
+	APIKey             string            `json:"apiKey"`
+	TTL                int               `json:"ttl"`
+	APIKeySecretKeyRef secretKeySelector `json:"apikeySecretKeyRef"`
+	// ClientIDSecretRef and ClientSecretSecretRef select an OAuth2 client ID
+	// and secret to authenticate with instead of an API key
+	ClientIDSecretRef     secretKeySelector `json:"clientIdSecretRef"`
+	ClientSecretSecretRef secretKeySelector `json:"clientSecretSecretRef"`
+	// APIBaseURL optionally replaces the public Dynu API endpoint, e.g. with
+	// a recording proxy or a local fake.
+	APIBaseURL string `json:"apiBaseURL,omitempty"`
+	// RateLimit and RateBurst optionally lower the Dynu API rate limit for
+	// this issuer. Its requests also draw from the process-wide bucket, and
+	// issuers with identical settings share a single token bucket.
+	RateLimit float64 `json:"rateLimit,omitempty"`
+	RateBurst int     `json:"rateBurst,omitempty"`
+}
+
+// secretKeySelector selects a key of a Secret, which may live in another
+// namespace than the challenge's if that namespace is allowed with
+// --allowed-secret-namespaces
+type secretKeySelector struct {
+	certmgrv1.SecretKeySelector `json:",inline"`
+	// Namespace of the Secret; defaults to the challenge's resource namespace
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // Name is used as the name for this DNS solver when referencing it on the ACME
@@ -102,31 +209,50 @@ func (c *dynuProviderSolver) Name() string {
 // This method should tolerate being called multiple times with the same value.
 // cert-manager itself will later perform a self check to ensure that the
 // solver has correctly configured the DNS provider.
-func (c *dynuProviderSolver) Present(ch *v1alpha1.ChallengeRequest) error {
+func (c *dynuProviderSolver) Present(ch *v1alpha1.ChallengeRequest) (err error) {
+	ctx, span := startChallengeSpan(c.context(), "Present", ch)
+	events := c.events.For(ch)
+	defer func() {
+		if err != nil {
+			events.Eventf(corev1.EventTypeWarning, reasonPresentFailed, "Presenting the TXT record in Dynu failed: %v", err)
+		}
+		observeChallenge("present", ch, err)
+		endSpan(span, err)
+	}()
+	log := challengeLogger(ch)
 	dynu, cfg, err := c.NewDynuClient(ch)
 	if err != nil {
-		klog.Error(fmt.Sprintf("\n\nUnable to create dynu client\nErr: %v\n", err))
+		log.Error(err, "unable to create Dynu client")
 		return err
 	}
+	dynu.OnEvent = events.dynuEvents()
 
-	hostname := extractHostName(ch.ResolvedFQDN, ch.ResolvedZone)
-	nodeName := strings.Replace(strings.Replace(ch.ResolvedFQDN, hostname, "", -1), ".", "", -1)
-	klog.Info("\n\nPresent DNSName ", ch.DNSName, "\nResolvedFQDN:", ch.ResolvedFQDN, "\nzone ", ch.ResolvedZone, "\nnodeName: ", nodeName, "\nvalue ", ch.Key)
+	zone, err := dynu.ResolveZone(ctx, ch.ResolvedFQDN)
+	if err != nil {
+		log.Error(err, "failed to find Dynu domain")
+		return err
+	}
+	span.SetAttributes(dynuclient.AttrDomainID.Int(zone.DomainID))
+	log = log.WithValues("domain", zone.DomainName, "domainID", zone.DomainID, "node", zone.NodeName)
+	log.V(logf.InfoLevel).Info("presenting challenge", "value", dynuclient.Redacted(ch.Key))
 
 	rec := dynuclient.DNSRecord{
-		NodeName:   nodeName,
+		NodeName:   zone.NodeName,
 		RecordType: "TXT",
 		TextData:   ch.Key,
 		TTL:        strconv.Itoa(cfg.TTL),
 		State:      true,
+		DomainID:   zone.DomainID,
+		DomainName: zone.DomainName,
 	}
 
-	dnsRecordID, err = dynu.CreateDNSRecord(rec)
+	recordID, err := dynu.CreateDNSRecordWithContext(ctx, rec)
 	if err != nil {
-		klog.Error(fmt.Sprintf("\n\nFailed to create DNS record\nErr: %v\n", err))
+		log.Error(err, "failed to create TXT record")
 		return err
 	}
-	klog.Flush()
+	c.challenges.Put(ctx, challengeKey(ch), challengeRecord{DomainID: rec.DomainID, RecordID: recordID, FQDN: ch.ResolvedFQDN})
+	log.V(logf.InfoLevel).Info("presented challenge", "recordID", recordID)
 	return nil
 }
 
@@ -136,22 +262,40 @@ func (c *dynuProviderSolver) Present(ch *v1alpha1.ChallengeRequest) error {
 // value provided on the ChallengeRequest should be cleaned up.
 // This is in order to facilitate multiple DNS validations for the same domain
 // concurrently.
-func (c *dynuProviderSolver) CleanUp(ch *v1alpha1.ChallengeRequest) error {
+func (c *dynuProviderSolver) CleanUp(ch *v1alpha1.ChallengeRequest) (err error) {
+	ctx, span := startChallengeSpan(c.context(), "CleanUp", ch)
+	events := c.events.For(ch)
+	defer func() {
+		if err != nil {
+			events.Eventf(corev1.EventTypeWarning, reasonCleanUpFailed, "Removing the TXT record from Dynu failed: %v", err)
+		}
+		observeChallenge("cleanup", ch, err)
+		endSpan(span, err)
+	}()
+	log := challengeLogger(ch)
 	dynu, _, err := c.NewDynuClient(ch)
 	if err != nil {
-		klog.Error(fmt.Sprintf("\n\nUnable to create dynu client\nErr: %v\n", err))
+		log.Error(err, "unable to create Dynu client")
 		return err
 	}
-	hostname := extractHostName(ch.ResolvedFQDN, ch.ResolvedZone)
-	nodeName := strings.Replace(strings.Replace(ch.ResolvedFQDN, hostname, "", -1), ".", "", -1)
-	klog.Info("\n\nCleanup DNSName ", ch.ResolvedFQDN, "\nzone ", ch.ResolvedZone, "\nnodeName: ", nodeName, "\nvalue ", ch.Key)
+	dynu.OnEvent = events.dynuEvents()
+	log.V(logf.InfoLevel).Info("cleaning up challenge", "zone", ch.ResolvedZone, "value", dynuclient.Redacted(ch.Key))
 
-	err = dynu.RemoveDNSRecord(nodeName, ch.Key)
+	key := challengeKey(ch)
+	if rec, ok := c.challenges.Get(key); ok {
+		span.SetAttributes(dynuclient.AttrDomainID.Int(rec.DomainID))
+		log.V(logf.DebugLevel).Info("deleting the recorded TXT record", "domainID", rec.DomainID, "recordID", rec.RecordID)
+		err = dynu.DeleteDNSRecordWithContext(ctx, rec.DomainID, rec.RecordID)
+	} else {
+		// Present ran in another process, or before a restart
+		err = c.removeRecord(ctx, dynu, ch)
+	}
 	if err != nil {
-		klog.Error(fmt.Sprintf("\n\nFailed to remove DNS record\nErr: %v\n", err))
+		log.Error(err, "failed to remove TXT record")
 		return err
 	}
-	klog.Flush()
+	c.challenges.Delete(ctx, key)
+	log.V(logf.InfoLevel).Info("cleaned up challenge")
 	return nil
 }
 
@@ -165,66 +309,287 @@ func (c *dynuProviderSolver) CleanUp(ch *v1alpha1.ChallengeRequest) error {
 // The stopCh can be used to handle early termination of the webhook, in cases
 // where a SIGTERM or similar signal is sent to the webhook process.
 func (c *dynuProviderSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
-	klog.Info("Group Name:", GroupName)
+	logger.V(logf.InfoLevel).Info("initializing", "groupName", GroupName)
+	dynuclient.SetDefaultLogger(logger.WithName("dynuclient"))
+	dynuclient.SetRedaction(redactLogs)
+	if !redactLogs {
+		logger.Info("log redaction is off, API keys, tokens and challenge keys will be logged")
+	}
+	if err := dynuclient.SetDefaultRateLimit(rateLimit, rateBurst); err != nil {
+		logger.Error(err, "failed to initialize")
+		return err
+	}
+	dynuclient.SetDefaultDomainCache(dynuclient.NewDomainCache(domainCacheTTL, negativeDomainCacheTTL))
+	httpClient, err := newDynuHTTPClient(httpClientConfig{
+		timeout:         dynuHTTPTimeout,
+		caFile:          dynuCAFile,
+		maxIdleConns:    dynuMaxIdleConns,
+		maxConnsPerHost: dynuMaxConnsPerHost,
+		idleConnTimeout: dynuIdleConnTimeout,
+	})
+	if err != nil {
+		logger.Error(err, "failed to initialize")
+		return err
+	}
+	// OAuth2 tokens are fetched through the same client
+	dynuclient.SetDefaultHTTPClient(httpClient)
+	c.httpClient = httpClient
 	///// UNCOMMENT THE BELOW CODE TO MAKE A KUBERNETES CLIENTSET AVAILABLE TO
 	///// YOUR CUSTOM DNS PROVIDER
 	cl, err := kubernetes.NewForConfig(kubeClientConfig)
 	if err != nil {
-		klog.Error(fmt.Sprintf("\n\nFailed to Initialize\nErr: %v\n", err))
+		logger.Error(err, "failed to initialize")
 		return err
 	}
-	c.client = *cl
-	klog.Flush()
+	c.client = cl
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	c.ctx = ctx
+	if secretCacheEnabled && len(secretCacheNamespaces) > 0 {
+		c.secrets = newSecretCache(c.client, stopCh, secretCacheNamespaces...)
+	}
+	if challengeEventsEnabled {
+		cmClient, err := cmclient.NewForConfig(kubeClientConfig)
+		if err != nil {
+			logger.Error(err, "failed to initialize")
+			return err
+		}
+		c.events = newChallengeEvents(cmClient, newEventRecorder(c.client, stopCh), stopCh)
+	}
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		// tracing is an aid, not a reason to stop solving challenges
+		logger.Error(err, "tracing is disabled")
+	} else if shutdownTracing != nil {
+		go func() {
+			<-stopCh
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			shutdownTracing(ctx)
+		}()
+	}
+	if metricsListenAddress != "" {
+		if err := serveMetrics(metricsListenAddress, stopCh); err != nil {
+			logger.Error(err, "failed to initialize")
+			return err
+		}
+	}
+
+	var persister challengePersister
+	if challengeStateConfigMap != "" {
+		if challengeStateNamespace == "" {
+			err := fmt.Errorf("--challenge-state-namespace or POD_NAMESPACE must be set to persist challenge state")
+			logger.Error(err, "failed to initialize")
+			return err
+		}
+		persister = newConfigMapPersister(c.client, challengeStateNamespace, challengeStateConfigMap)
+	}
+	c.challenges = newChallengeStore(persister)
+	if err := c.challenges.Load(ctx); err != nil {
+		// CleanUp falls back to searching Dynu for records it doesn't know
+		logger.Error(err, "failed to load persisted challenge records")
+	}
 	///// END OF CODE TO MAKE KUBERNETES CLIENTSET AVAILABLEuri := cfg.BaseURL + cfg.DomainId + "/" + cfg.EndPoint
 	return nil
 }
 
+// context returns the solver's root context, falling back to
+// context.Background() when Initialize hasn't been called
+func (c *dynuProviderSolver) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
 // loadConfig is a small helper function that decodes JSON configuration into
-// the typed config struct.
+// the typed config struct. Unknown fields are rejected and the result is
+// validated, see dynuProviderConfig.Validate.
 func loadConfig(cfgJSON *extapi.JSON) (dynuProviderConfig, error) {
 	cfg := dynuProviderConfig{}
-	// handle the 'base case' where no configuration has been provided
-	if cfgJSON == nil {
-		return cfg, nil
+	if cfgJSON != nil {
+		dec := json.NewDecoder(bytes.NewReader(cfgJSON.Raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return cfg, fmt.Errorf("error decoding solver config: %v", err)
+		}
 	}
-	if err := json.Unmarshal(cfgJSON.Raw, &cfg); err != nil {
-		klog.Error(fmt.Sprintf("\nInit...Err: %v\n", err))
-		return cfg, fmt.Errorf("error decoding solver config: %v", err)
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid solver config: %v", err)
 	}
 
 	return cfg, nil
 }
 
-// getCredentials gets the APIKey and decodes it for later use
+// rateLimit returns the token bucket settings for this config, filling in
+// the process-wide defaults for anything left unset. An issuer can only
+// lower the limits, never raise them above the process-wide ones.
+func (cfg *dynuProviderConfig) rateLimit() (float64, int) {
+	limit, burst := cfg.RateLimit, cfg.RateBurst
+	if limit == 0 || limit > rateLimit {
+		limit = rateLimit
+	}
+	if burst == 0 || burst > rateBurst {
+		burst = rateBurst
+	}
+	return limit, burst
+}
+
+// getCredentials gets the API key, or the OAuth2 client ID and secret when
+// those are configured
 func (c *dynuProviderSolver) getCredentials(config *dynuProviderConfig, ns string) (*dynuclient.DynuCreds, error) {
 
 	creds := dynuclient.DynuCreds{}
 
-	if config.APIKey != "" {
-		creds.APIKey = config.APIKey
-	} else {
-		secret, err := c.client.CoreV1().Secrets(ns).Get(context.Background(), config.APIKeySecretKeyRef.Name, metav1.GetOptions{})
-		if err != nil {
-			return nil, fmt.Errorf("failed to load secret %q", ns+"/"+config.APIKeySecretKeyRef.Name)
+	if err := checkSharedSecretBaseURL(config, ns); err != nil {
+		return nil, err
+	}
+	if config.ClientIDSecretRef.Name != "" || config.ClientSecretSecretRef.Name != "" {
+		if config.ClientIDSecretRef.Name == "" || config.ClientSecretSecretRef.Name == "" {
+			return nil, fmt.Errorf("clientIdSecretRef and clientSecretSecretRef must be set together")
+		}
+		var err error
+		if creds.ClientID, err = c.secretValue(ns, config.ClientIDSecretRef); err != nil {
+			return nil, err
 		}
-		if apikey, ok := secret.Data[config.APIKeySecretKeyRef.Key]; ok {
-			decodedKey, err := b64.StdEncoding.DecodeString(strings.TrimSpace(string(apikey)))
-			if err != nil {
-				return nil, err
-			}
-			creds.APIKey = strings.TrimSpace(string(decodedKey))
-		} else {
-			return nil, fmt.Errorf("no key %q in secret %q", config.APIKeySecretKeyRef, ns+"/"+config.APIKeySecretKeyRef.Name)
+		if creds.ClientSecret, err = c.secretValue(ns, config.ClientSecretSecretRef); err != nil {
+			return nil, err
 		}
+		return &creds, nil
+	}
+
+	if config.APIKey != "" {
+		creds.APIKey = strings.TrimSpace(config.APIKey)
+		return &creds, nil
+	}
+	if config.APIKeySecretKeyRef.Name == "" {
+		return nil, fmt.Errorf("no API key configured, set apikeySecretKeyRef")
+	}
+	value, err := c.secretValue(ns, config.APIKeySecretKeyRef)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := decodeLegacyAPIKey(value); ok {
+		logger.Info("the API key is base64 encoded twice, decoding it once more", "secret", config.APIKeySecretKeyRef.Name)
+		value = key
 	}
+	creds.APIKey = value
 	return &creds, nil
 }
 
-func extractHostName(fqdn, zone string) string {
-	subdomain := strings.Replace(fqdn, zone, "", -1) // e.g. challenge.www.
-	splitSub := strings.Split(subdomain, ".")
-	hostname := splitSub[1] + "." + strings.TrimSuffix(zone, ".")
-	return hostname
+// decodeLegacyAPIKey undoes the extra base64 encoding older releases
+// expected on top of the one Kubernetes applies to Secret data. A value only
+// counts as encoded when it decodes to printable ASCII without spaces, which
+// a raw Dynu API key practically never does.
+func decodeLegacyAPIKey(value string) (string, bool) {
+	decoded, err := b64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", false
+	}
+	key := strings.TrimSpace(string(decoded))
+	if key == "" {
+		return "", false
+	}
+	for _, r := range key {
+		if r <= ' ' || r > '~' {
+			return "", false
+		}
+	}
+	return key, true
+}
+
+// secretValue reads the value sel points to from a Secret in ns, or in the
+// namespace sel names, with surrounding whitespace removed
+func (c *dynuProviderSolver) secretValue(ns string, sel secretKeySelector) (string, error) {
+	ns, err := resolveSecretNamespace(ns, sel)
+	if err != nil {
+		return "", err
+	}
+	name := ns + "/" + sel.Name
+	if sel.Key == "" {
+		return "", fmt.Errorf("no key given for secret %q", name)
+	}
+	secret, err := c.getSecret(ns, sel.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to load secret %q: %v", name, err)
+	}
+	raw, ok := secret.Data[sel.Key]
+	if !ok {
+		return "", fmt.Errorf("no key %q in secret %q", sel.Key, name)
+	}
+	value := strings.TrimSpace(string(raw))
+	if value == "" {
+		return "", fmt.Errorf("key %q in secret %q is empty", sel.Key, name)
+	}
+	return value, nil
+}
+
+// resolveSecretNamespace returns the namespace to read sel from for a challenge in
+// ns, checking explicit namespaces against the allowlist
+func resolveSecretNamespace(ns string, sel secretKeySelector) (string, error) {
+	if sel.Namespace == "" || sel.Namespace == ns {
+		if ns == "" {
+			return "", fmt.Errorf("secret %q names no namespace and the challenge has no resource namespace", sel.Name)
+		}
+		return ns, nil
+	}
+	for _, allowed := range allowedSecretNamespaces {
+		if sel.Namespace == allowed {
+			return sel.Namespace, nil
+		}
+	}
+	return "", fmt.Errorf("secret %q is in namespace %q, which is not allowed; add it to --allowed-secret-namespaces", sel.Name, sel.Namespace)
+}
+
+// checkSharedSecretBaseURL refuses to send credentials read from another
+// namespace anywhere but Dynu's own API. An issuer may set apiBaseURL, so
+// otherwise it could have a Secret it was allowed to share sent to a server
+// of its choosing.
+func checkSharedSecretBaseURL(config *dynuProviderConfig, ns string) error {
+	if config.APIBaseURL == "" || strings.TrimSuffix(config.APIBaseURL, "/") == dynuclient.DefaultBaseURL {
+		return nil
+	}
+	for _, sel := range []secretKeySelector{config.APIKeySecretKeyRef, config.ClientIDSecretRef, config.ClientSecretSecretRef} {
+		if sel.Name != "" && sel.Namespace != "" && sel.Namespace != ns {
+			return fmt.Errorf("secret %q is in namespace %q, which may only be used with the default apiBaseURL", sel.Name, sel.Namespace)
+		}
+	}
+	return nil
+}
+
+// resourceNamespace returns the namespace the challenge's credentials are
+// read from by default. cert-manager sets it to the Issuer's namespace, or
+// its cluster resource namespace for ClusterIssuers; when it's empty, the
+// webhook's --cluster-resource-namespace is used instead.
+func resourceNamespace(ch *v1alpha1.ChallengeRequest) string {
+	if ch.ResourceNamespace == "" {
+		return clusterResourceNamespace
+	}
+	return ch.ResourceNamespace
+}
+
+// removeRecord searches Dynu for the challenge's TXT record and deletes it
+func (c *dynuProviderSolver) removeRecord(ctx context.Context, dynu *dynuclient.DynuClient, ch *v1alpha1.ChallengeRequest) error {
+	zone, err := dynu.ResolveZone(ctx, ch.ResolvedFQDN)
+	if err != nil {
+		return err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(dynuclient.AttrDomainID.Int(zone.DomainID))
+	log := challengeLogger(ch).WithValues("domain", zone.DomainName, "domainID", zone.DomainID, "node", zone.NodeName)
+	log.V(logf.DebugLevel).Info("searching Dynu for the TXT record")
+	rec, err := dynu.FindTXTRecord(ctx, zone, ch.Key)
+	if errors.Is(err, dynuclient.ErrRecordNotFound) {
+		log.V(logf.ExtendedInfoLevel).Info("TXT record is already gone")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return dynu.DeleteDNSRecordWithContext(ctx, zone.DomainID, rec.ID)
 }
 
 // NewDynuClient - Create a new DynuClient
@@ -234,14 +599,127 @@ func (c *dynuProviderSolver) NewDynuClient(ch *v1alpha1.ChallengeRequest) (*dynu
 		return nil, &cfg, err
 	}
 
-	creds, err := c.getCredentials(&cfg, ch.ResourceNamespace)
+	creds, err := c.getCredentials(&cfg, resourceNamespace(ch))
 	if err != nil {
 		return nil, &cfg, fmt.Errorf("error getting credentials: %v", err)
 	}
 
-	hostname := extractHostName(ch.ResolvedFQDN, ch.ResolvedZone)
-	klog.Info(fmt.Sprintf("\n******\n\nHostName: %v\n\n******\n", hostname))
-	client := &dynuclient.DynuClient{HostName: hostname, APIKey: creds.APIKey, HTTPClient: c.httpClient}
+	hostname := strings.TrimSuffix(ch.ResolvedZone, ".")
+	log := challengeLogger(ch).WithName("dynuclient")
+	client := &dynuclient.DynuClient{HostName: hostname, APIKey: creds.APIKey, HTTPClient: c.dynuHTTPClient(), BaseURL: cfg.APIBaseURL, RateLimiter: c.limiter, Log: log}
+	if creds.ClientID != "" {
+		client.Auth = dynuclient.SharedOAuth2Auth(oauth2Issuer(resourceNamespace(ch), &cfg), dynuclient.TokenURL(cfg.APIBaseURL), creds.ClientID, creds.ClientSecret)
+		log.V(logf.DebugLevel).Info("using OAuth2 credentials", "clientID", creds.ClientID, "clientSecret", dynuclient.Redacted(creds.ClientSecret))
+	} else {
+		log.V(logf.DebugLevel).Info("using API key", "apiKey", dynuclient.Redacted(creds.APIKey))
+	}
+	if cfg.RateLimit != 0 || cfg.RateBurst != 0 {
+		// the issuer's requests still count against the process-wide budget
+		client.RateLimiter = dynuclient.ChainLimiters(c.dynuLimiter(), dynuclient.SharedLimiter(cfg.rateLimit()))
+	}
 
 	return client, &cfg, nil
 }
+
+// oauth2Issuer identifies the issuer whose OAuth2 credentials cfg refers
+// to, by the Secrets they're read from and the API they're used with
+func oauth2Issuer(ns string, cfg *dynuProviderConfig) string {
+	ref := func(sel secretKeySelector) string {
+		return sel.Namespace + "/" + sel.Name + "/" + sel.Key
+	}
+	return strings.Join([]string{ns, ref(cfg.ClientIDSecretRef), ref(cfg.ClientSecretSecretRef), dynuclient.TokenURL(cfg.APIBaseURL)}, ",")
+}
+
+// dynuLimiter returns the limiter every DynuClient draws from
+func (c *dynuProviderSolver) dynuLimiter() dynuclient.Limiter {
+	if c.limiter != nil {
+		return c.limiter
+	}
+	return dynuclient.DefaultLimiter()
+}
+
+// envFloat reads a float64 from the environment, returning def when the
+// variable is unset or malformed
+func envFloat(name string, def float64) float64 {
+	if v, ok := os.LookupEnv(name); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			return f
+		}
+		logger.Error(err, "ignoring malformed environment variable", "name", name, "value", v)
+	}
+	return def
+}
+
+// envInt reads an int from the environment, returning def when the variable
+// is unset or malformed
+func envInt(name string, def int) int {
+	if v, ok := os.LookupEnv(name); ok {
+		i, err := strconv.Atoi(v)
+		if err == nil {
+			return i
+		}
+		logger.Error(err, "ignoring malformed environment variable", "name", name, "value", v)
+	}
+	return def
+}
+
+// envDuration reads a duration such as "90s" from the environment, returning
+// def when the variable is unset or malformed
+func envDuration(name string, def time.Duration) time.Duration {
+	if v, ok := os.LookupEnv(name); ok {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			return d
+		}
+		logger.Error(err, "ignoring malformed environment variable", "name", name, "value", v)
+	}
+	return def
+}
+
+// envBool reads a bool from the environment, returning def when the variable
+// is unset or malformed
+func envBool(name string, def bool) bool {
+	if v, ok := os.LookupEnv(name); ok {
+		b, err := strconv.ParseBool(v)
+		if err == nil {
+			return b
+		}
+		logger.Error(err, "ignoring malformed environment variable", "name", name, "value", v)
+	}
+	return def
+}
+
+// envString reads a string from the environment, returning def when the
+// variable is unset. A variable that is set but empty is returned as is, so
+// e.g. METRICS_LISTEN_ADDRESS="" disables metrics.
+func envString(name string, def string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return def
+}
+
+// stringList is a comma-separated list flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = stringList(nil)
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// envStringList reads a comma-separated list from the environment
+func envStringList(name string) stringList {
+	var l stringList
+	l.Set(os.Getenv(name))
+	return l
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
 	"github.com/gstore/cert-manager-webhook-dynu/test"
 	logf "github.com/jetstack/cert-manager/pkg/logs"
 	"github.com/jetstack/cert-manager/test/acme/dns/server"
@@ -41,26 +45,9 @@ func TestRunsSuite(t *testing.T) {
 		log.Fatal(err)
 	}
 
-	ctx := logf.NewContext(nil, nil, t.Name())
-	srv := &server.BasicServer{
-		Handler: &test.DNSHandler{
-			Log: logf.FromContext(ctx, "dnsBasicServer"),
-			TxtRecords: map[string][][]string{
-				fqdn: {
-					{},
-					{},
-					{"123d=="},
-					{"123d=="},
-				},
-			},
-			Zones: []string{zone},
-		},
-	}
-
 	fixture := dns.NewFixture(&dynuProviderSolver{},
 		dns.SetResolvedZone(zone),
 		dns.SetResolvedFQDN(fqdn),
-		dns.SetDNSServer(srv.ListenAddr()),
 		dns.SetAllowAmbientCredentials(false),
 		dns.SetBinariesPath(kubeBuilderBinPath),
 		dns.SetStrict(true),
@@ -93,3 +80,53 @@ func TestRunSuiteWithSecret(t *testing.T) {
 
 	fixture.RunConformance(t)
 }
+
+// TestRunsSuiteOffline runs the conformance suite against a fake Dynu API,
+// so it needs no Dynu account or network access
+func TestRunsSuiteOffline(t *testing.T) {
+	if _, err := os.Stat(filepath.Join(kubeBuilderBinPath, "kube-apiserver")); err != nil {
+		t.Skipf("kubebuilder binaries not found in %s; run scripts/fetch-test-binaries.sh", kubeBuilderBinPath)
+	}
+	zone := "example.com."
+	fqdn := nodeName + zone
+
+	api := dynutest.NewServer("offline-api-key", zone)
+	defer api.Close()
+
+	// the DNS server answers from the fake API's records, so the suite's
+	// propagation checks see exactly what the webhook wrote
+	ctx := logf.NewContext(nil, nil, t.Name())
+	srv := &server.BasicServer{
+		Handler: &test.DNSHandler{
+			Log:     logf.FromContext(ctx, "dnsBasicServer"),
+			Zones:   []string{zone},
+			Records: api,
+		},
+	}
+	if err := srv.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown()
+
+	fixture := dns.NewFixture(&dynuProviderSolver{},
+		dns.SetResolvedZone(zone),
+		dns.SetResolvedFQDN(fqdn),
+		dns.SetDNSServer(srv.ListenAddr()),
+		dns.SetAllowAmbientCredentials(false),
+		dns.SetBinariesPath(kubeBuilderBinPath),
+		dns.SetStrict(true),
+		// the fake zone's NS names don't resolve, so query the test server directly
+		dns.SetUseAuthoritative(false),
+		dns.SetPollInterval(100*time.Millisecond),
+		dns.SetPropagationLimit(10*time.Second),
+		dns.SetConfig(&extapi.JSON{
+			Raw: []byte(fmt.Sprintf(`{"apiKey": %q, "ttl": 60, "apiBaseURL": %q}`, api.APIKey, api.URL)),
+		}),
+	)
+
+	fixture.RunConformance(t)
+
+	if recs := api.Records(); len(recs) != 0 {
+		t.Errorf("expected every record to be cleaned up, found %v", recs)
+	}
+}
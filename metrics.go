@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynuclient"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	logf "github.com/jetstack/cert-manager/pkg/logs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	challengesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dynu",
+		Subsystem: "webhook",
+		Name:      "challenges_total",
+		Help:      "Present and CleanUp calls by operation, outcome and domain.",
+	}, []string{"operation", "outcome", "domain"})
+
+	activeChallengeRecords = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "dynu",
+		Subsystem: "webhook",
+		Name:      "active_challenge_records",
+		Help:      "Challenge TXT records presented and not yet cleaned up.",
+	})
+)
+
+// newMetricsRegistry returns a registry with the webhook's, the Dynu client's
+// and the Go runtime's metrics
+func newMetricsRegistry() (*prometheus.Registry, error) {
+	reg := prometheus.NewRegistry()
+	for _, c := range []prometheus.Collector{
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		challengesTotal,
+		activeChallengeRecords,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	if err := dynuclient.RegisterMetrics(reg); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// serveMetrics serves /metrics on addr until stopCh is closed
+func serveMetrics(addr string, stopCh <-chan struct{}) error {
+	reg, err := newMetricsRegistry()
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		logger.V(logf.InfoLevel).Info("serving metrics", "address", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error(err, "metrics server failed", "address", addr)
+		}
+	}()
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+	return nil
+}
+
+// observeChallenge counts a Present or CleanUp call for the zone of ch
+func observeChallenge(operation string, ch *v1alpha1.ChallengeRequest, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	domain := strings.ToLower(strings.TrimSuffix(ch.ResolvedZone, "."))
+	challengesTotal.WithLabelValues(operation, outcome, domain).Inc()
+}
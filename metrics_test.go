@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+func TestChallengeMetrics(t *testing.T) {
+	api := dynutest.NewServer("test-api-key", "metrics.example.com")
+	defer api.Close()
+
+	solver := &dynuProviderSolver{challenges: newChallengeStore(nil), limiter: unlimited}
+	ch := &v1alpha1.ChallengeRequest{
+		UID:          "metrics-uid",
+		ResolvedFQDN: "_acme-challenge.metrics.example.com.",
+		ResolvedZone: "metrics.example.com.",
+		Key:          "123d==",
+		Config:       &extapi.JSON{Raw: []byte(fmt.Sprintf(`{"apiKey": %q, "apiBaseURL": %q}`, api.APIKey, api.URL))},
+	}
+	count := func(operation, outcome string) float64 {
+		return testutil.ToFloat64(challengesTotal.WithLabelValues(operation, outcome, "metrics.example.com"))
+	}
+
+	assert.NoError(t, solver.Present(ch))
+	assert.Equal(t, 1.0, count("present", "success"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(activeChallengeRecords))
+
+	assert.NoError(t, solver.CleanUp(ch))
+	assert.Equal(t, 1.0, count("cleanup", "success"))
+	assert.Equal(t, 0.0, testutil.ToFloat64(activeChallengeRecords))
+
+	ch.Config = &extapi.JSON{Raw: []byte(`{}`)}
+	assert.Error(t, solver.Present(ch))
+	assert.Equal(t, 1.0, count("present", "error"))
+
+	reg, err := newMetricsRegistry()
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := httptest.NewServer(promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `dynu_webhook_challenges_total{domain="metrics.example.com",operation="present",outcome="success"} 1`)
+	assert.Contains(t, string(body), `dynu_api_requests_total{code="200",endpoint="/dns/getroot/{hostname}",method="GET"}`)
+}
+
+func TestMetricsListenAddressFromEnv(t *testing.T) {
+	const name = "METRICS_LISTEN_ADDRESS"
+	old, set := os.LookupEnv(name)
+	defer func() {
+		if set {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	}()
+
+	os.Unsetenv(name)
+	assert.Equal(t, "0.0.0.0:9402", envString(name, "0.0.0.0:9402"))
+	os.Setenv(name, "127.0.0.1:9000")
+	assert.Equal(t, "127.0.0.1:9000", envString(name, "0.0.0.0:9402"))
+	// the chart sets it empty when metrics.enabled is false
+	os.Setenv(name, "")
+	assert.Equal(t, "", envString(name, "0.0.0.0:9402"), "an empty value should disable metrics")
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// otlpExporter sends spans to an OTLP/HTTP endpoint using the JSON
+// encoding. The OTLP exporters of opentelemetry-go need a newer gRPC than
+// the Kubernetes libraries this webhook is built with allow, so spans are
+// encoded here instead; the JSON encoding is part of the OTLP spec and
+// accepted by the OpenTelemetry Collector and most tracing backends.
+type otlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func (e *otlpExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(otlpTraces(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("exporting spans to %s: %v", e.endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("exporting spans to %s: %s: %s", e.endpoint, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// The types below mirror the JSON mapping of the OTLP trace protobuf
+// messages. 64 bit integers are strings and IDs are hex encoded, as OTLP
+// requires.
+
+type otlpTraceData struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	SchemaURL  string           `json:"schemaUrl,omitempty"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID                string         `json:"traceId"`
+	SpanID                 string         `json:"spanId"`
+	ParentSpanID           string         `json:"parentSpanId,omitempty"`
+	Name                   string         `json:"name"`
+	Kind                   int            `json:"kind"`
+	StartTimeUnixNano      string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano        string         `json:"endTimeUnixNano"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+	Events                 []otlpEvent    `json:"events,omitempty"`
+	Status                 otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+// OTLP status codes, which are numbered differently from codes.Code
+const (
+	otlpStatusOk    = 1
+	otlpStatusError = 2
+)
+
+// otlpTraces groups spans by resource and instrumentation library
+func otlpTraces(spans []sdktrace.ReadOnlySpan) otlpTraceData {
+	type scopeKey struct {
+		resource attribute.Distinct
+		library  instrumentation.Library
+	}
+	var (
+		data      otlpTraceData
+		resources = map[attribute.Distinct]int{}
+		scopes    = map[scopeKey]int{}
+	)
+	for _, span := range spans {
+		res := span.Resource()
+		if res == nil {
+			res = resource.Empty()
+		}
+		ri, ok := resources[res.Equivalent()]
+		if !ok {
+			ri = len(data.ResourceSpans)
+			resources[res.Equivalent()] = ri
+			data.ResourceSpans = append(data.ResourceSpans, otlpResourceSpans{
+				Resource:  otlpResource{Attributes: otlpAttributes(res.Attributes())},
+				SchemaURL: res.SchemaURL(),
+			})
+		}
+		rs := &data.ResourceSpans[ri]
+		key := scopeKey{resource: res.Equivalent(), library: span.InstrumentationLibrary()}
+		si, ok := scopes[key]
+		if !ok {
+			si = len(rs.ScopeSpans)
+			scopes[key] = si
+			rs.ScopeSpans = append(rs.ScopeSpans, otlpScopeSpans{
+				Scope: otlpScope{Name: key.library.Name, Version: key.library.Version},
+			})
+		}
+		rs.ScopeSpans[si].Spans = append(rs.ScopeSpans[si].Spans, otlpSpanFrom(span))
+	}
+	return data
+}
+
+func otlpSpanFrom(span sdktrace.ReadOnlySpan) otlpSpan {
+	sc := span.SpanContext()
+	traceID, spanID := sc.TraceID(), sc.SpanID()
+	s := otlpSpan{
+		TraceID:                hex.EncodeToString(traceID[:]),
+		SpanID:                 hex.EncodeToString(spanID[:]),
+		Name:                   span.Name(),
+		Kind:                   int(span.SpanKind()),
+		StartTimeUnixNano:      strconv.FormatInt(span.StartTime().UnixNano(), 10),
+		EndTimeUnixNano:        strconv.FormatInt(span.EndTime().UnixNano(), 10),
+		Attributes:             otlpAttributes(span.Attributes()),
+		DroppedAttributesCount: span.DroppedAttributes(),
+	}
+	if parent := span.Parent(); parent.IsValid() {
+		parentID := parent.SpanID()
+		s.ParentSpanID = hex.EncodeToString(parentID[:])
+	}
+	for _, event := range span.Events() {
+		s.Events = append(s.Events, otlpEvent{
+			TimeUnixNano: strconv.FormatInt(event.Time.UnixNano(), 10),
+			Name:         event.Name,
+			Attributes:   otlpAttributes(event.Attributes),
+		})
+	}
+	switch status := span.Status(); status.Code {
+	case codes.Ok:
+		s.Status.Code = otlpStatusOk
+	case codes.Error:
+		s.Status = otlpStatus{Code: otlpStatusError, Message: status.Description}
+	}
+	return s
+}
+
+func otlpAttributes(attrs []attribute.KeyValue) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		kvs = append(kvs, otlpKeyValue{Key: string(kv.Key), Value: otlpValue(kv.Value)})
+	}
+	return kvs
+}
+
+func otlpValue(v attribute.Value) otlpAnyValue {
+	str := func(s string) otlpAnyValue { return otlpAnyValue{StringValue: &s} }
+	boolean := func(b bool) otlpAnyValue { return otlpAnyValue{BoolValue: &b} }
+	integer := func(i int64) otlpAnyValue {
+		s := strconv.FormatInt(i, 10)
+		return otlpAnyValue{IntValue: &s}
+	}
+	double := func(f float64) otlpAnyValue { return otlpAnyValue{DoubleValue: &f} }
+	array := func(values []otlpAnyValue) otlpAnyValue {
+		return otlpAnyValue{ArrayValue: &otlpArrayValue{Values: values}}
+	}
+
+	switch v.Type() {
+	case attribute.BOOL:
+		return boolean(v.AsBool())
+	case attribute.INT64:
+		return integer(v.AsInt64())
+	case attribute.FLOAT64:
+		return double(v.AsFloat64())
+	case attribute.STRING:
+		return str(v.AsString())
+	case attribute.BOOLSLICE:
+		var values []otlpAnyValue
+		for _, b := range v.AsBoolSlice() {
+			values = append(values, boolean(b))
+		}
+		return array(values)
+	case attribute.INT64SLICE:
+		var values []otlpAnyValue
+		for _, i := range v.AsInt64Slice() {
+			values = append(values, integer(i))
+		}
+		return array(values)
+	case attribute.FLOAT64SLICE:
+		var values []otlpAnyValue
+		for _, f := range v.AsFloat64Slice() {
+			values = append(values, double(f))
+		}
+		return array(values)
+	case attribute.STRINGSLICE:
+		var values []otlpAnyValue
+		for _, s := range v.AsStringSlice() {
+			values = append(values, str(s))
+		}
+		return array(values)
+	}
+	return str(v.Emit())
+}
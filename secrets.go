@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+
+	logf "github.com/jetstack/cert-manager/pkg/logs"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// secretCache serves Secrets from informers so challenges don't each cost a
+// request to the API server, and rotated credentials are picked up as soon
+// as they change. It watches the Secrets of the namespaces it's given, the
+// ones credentials are kept in and the chart grants list and watch in, with
+// an informer per namespace that is started right away. Secrets elsewhere
+// are always fetched with a GET, as are those looked up before the informer
+// has synced or that it hasn't seen.
+type secretCache struct {
+	client     kubernetes.Interface
+	namespaces map[string]*cachedNamespace
+}
+
+type cachedNamespace struct {
+	lister corelisters.SecretNamespaceLister
+	synced cache.InformerSynced
+}
+
+// newSecretCache starts watching the Secrets in namespaces until stopCh is
+// closed
+func newSecretCache(client kubernetes.Interface, stopCh <-chan struct{}, namespaces ...string) *secretCache {
+	s := &secretCache{client: client, namespaces: map[string]*cachedNamespace{}}
+	for _, ns := range namespaces {
+		if ns == "" || s.namespaces[ns] != nil {
+			continue
+		}
+		factory := informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithNamespace(ns))
+		secrets := factory.Core().V1().Secrets()
+		s.namespaces[ns] = &cachedNamespace{
+			lister: secrets.Lister().Secrets(ns),
+			synced: secrets.Informer().HasSynced,
+		}
+		factory.Start(stopCh)
+		logger.V(logf.InfoLevel).Info("started Secret informer", "namespace", ns)
+	}
+	return s
+}
+
+// Get returns the Secret ns/name
+func (s *secretCache) Get(ctx context.Context, ns, name string) (*corev1.Secret, error) {
+	if cached := s.namespaces[ns]; cached != nil && cached.synced() {
+		secret, err := cached.lister.Get(name)
+		if err == nil {
+			return secret, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "Secret cache lookup failed, asking the API server", "namespace", ns, "name", name)
+		}
+	}
+	return s.client.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+}
+
+// getSecret reads a Secret through the solver's cache, or straight from the
+// API server when there is none
+func (c *dynuProviderSolver) getSecret(ns, name string) (*corev1.Secret, error) {
+	if c.secrets != nil {
+		return c.secrets.Get(c.context(), ns, name)
+	}
+	return c.client.CoreV1().Secrets(ns).Get(c.context(), name, metav1.GetOptions{})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	certmgrv1 "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func secretGets(client *fake.Clientset) int {
+	n := 0
+	for _, a := range client.Actions() {
+		if a.Matches("get", "secrets") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSecretCache(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "dynu-credentials", Namespace: "cert-manager"},
+		Data:       map[string][]byte{"apikey": []byte("old-key")},
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	secrets := newSecretCache(client, stopCh, "cert-manager")
+
+	// the informer starts with the cache, before any lookup
+	cached := secrets.namespaces["cert-manager"]
+	if !assert.NotNil(t, cached) {
+		return
+	}
+	assert.NoError(t, wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) { return cached.synced(), nil }))
+	secret, err := secrets.Get(ctx, "cert-manager", "dynu-credentials")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "old-key", string(secret.Data["apikey"]))
+	}
+	assert.Equal(t, 0, secretGets(client), "synced lookups should be served from the cache")
+
+	// rotated credentials show up without a restart
+	secret = secret.DeepCopy()
+	secret.Data["apikey"] = []byte("new-key")
+	_, err = client.CoreV1().Secrets("cert-manager").Update(ctx, secret, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		secret, err := secrets.Get(ctx, "cert-manager", "dynu-credentials")
+		return err == nil && string(secret.Data["apikey"]) == "new-key", nil
+	}))
+
+	// Secrets the informer hasn't seen are fetched directly
+	_, err = secrets.Get(ctx, "cert-manager", "missing")
+	assert.Error(t, err)
+	assert.Equal(t, 1, secretGets(client))
+}
+
+func TestSecretCacheServesIssuerNamespace(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "dynu-credentials", Namespace: "apps"},
+		Data:       map[string][]byte{"apikey": []byte("key")},
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	// the webhook's own namespace and the Issuer's are both configured
+	secrets := newSecretCache(client, stopCh, "cert-manager", "apps")
+	assert.NoError(t, wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return secrets.namespaces["apps"].synced(), nil
+	}))
+	solver := &dynuProviderSolver{client: client, secrets: secrets}
+
+	// a namespaced Issuer's secret selector resolves to its own namespace
+	for i := 0; i < 2; i++ {
+		value, err := solver.secretValue("apps", secretRef("dynu-credentials", "apikey"))
+		assert.NoError(t, err)
+		assert.Equal(t, "key", value)
+	}
+	assert.Equal(t, 0, secretGets(client), "Secrets in an Issuer's namespace should be served from the cache")
+}
+
+func TestSecretCacheOnlyWatchesGivenNamespaces(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "dynu-credentials", Namespace: "issuers"},
+		Data:       map[string][]byte{"apikey": []byte("key")},
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	secrets := newSecretCache(client, stopCh, "cert-manager", "")
+	assert.NoError(t, wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return secrets.namespaces["cert-manager"].synced(), nil
+	}))
+
+	for i := 0; i < 2; i++ {
+		_, err := secrets.Get(ctx, "issuers", "dynu-credentials")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, secretGets(client), "Secrets outside the watched namespaces should be fetched every time")
+	assert.Len(t, secrets.namespaces, 1)
+	for _, a := range client.Actions() {
+		if a.Matches("list", "secrets") || a.Matches("watch", "secrets") {
+			assert.Equal(t, "cert-manager", a.GetNamespace(), "only the given namespaces should be watched")
+		}
+	}
+}
+
+func TestSecretCacheFallsBackWhenListForbidden(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "dynu-credentials", Namespace: "issuers"},
+		Data:       map[string][]byte{"apikey": []byte("key")},
+	})
+	client.PrependReactor("list", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "", nil)
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	solver := &dynuProviderSolver{client: client, secrets: newSecretCache(client, stopCh, "issuers")}
+
+	for i := 0; i < 2; i++ {
+		value, err := solver.secretValue("issuers", secretRef("dynu-credentials", "apikey"))
+		assert.NoError(t, err)
+		assert.Equal(t, "key", value)
+	}
+}
+
+func secretRef(name, key string) secretKeySelector {
+	return secretKeySelector{SecretKeySelector: certmgrv1.SecretKeySelector{LocalObjectReference: certmgrv1.LocalObjectReference{Name: name}, Key: key}}
+}
@@ -17,7 +17,7 @@ limitations under the License.
 package test
 
 import (
-	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/go-logr/logr"
@@ -28,47 +28,145 @@ const (
 	defaultTTL = 1
 )
 
-var requestCount = map[string]int{}
-var count int = 1
+// TXTSource supplies the TXT records a DNSHandler serves. A
+// *dynutest.Server satisfies it, so DNS answers reflect exactly what the
+// webhook wrote to the fake Dynu API.
+type TXTSource interface {
+	TXT(fqdn string) []string
+}
+
+// TXTRecords is a concurrency-safe TXTSource for tests that write records
+// directly
+type TXTRecords struct {
+	lock    sync.Mutex
+	records map[string][]string
+}
+
+// Add adds a TXT value for fqdn
+func (r *TXTRecords) Add(fqdn, value string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.records == nil {
+		r.records = map[string][]string{}
+	}
+	name := canonical(fqdn)
+	r.records[name] = append(r.records[name], value)
+}
+
+// Remove removes a TXT value from fqdn
+func (r *TXTRecords) Remove(fqdn, value string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.records == nil {
+		return
+	}
+	name := canonical(fqdn)
+	values := r.records[name][:0]
+	for _, v := range r.records[name] {
+		if v != value {
+			values = append(values, v)
+		}
+	}
+	r.records[name] = values
+}
+
+// TXT implements TXTSource
+func (r *TXTRecords) TXT(fqdn string) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.records[canonical(fqdn)]...)
+}
 
-// DNSHandler ...
+// DNSHandler is an authoritative in-memory DNS server for Zones. It answers
+// SOA and NS queries for each zone apex and TXT queries from Records, so the
+// conformance suite's self-check and propagation steps see the live state.
 type DNSHandler struct {
 	Log logr.Logger
 
-	TxtRecords map[string][][]string
-	Zones      []string
-	tsigZone   string
-	lock       sync.Mutex
+	// Zones the handler is authoritative for, e.g. "example.com."
+	Zones []string
+	// Records supplies the TXT records served within Zones
+	Records TXTSource
 }
 
 // ServeDNS ...  implements github.com/miekg/dns.Handler
-// Imitates a DNS server
 func (b *DNSHandler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
-	b.lock.Lock()
-	defer b.lock.Unlock()
 	log := b.Log.WithName("serveDNS")
 	m := new(dns.Msg)
 	m.SetReply(req)
 	defer w.WriteMsg(m)
 
-	log.Info(m.String())
+	if len(req.Question) != 1 {
+		m.SetRcode(req, dns.RcodeFormatError)
+		return
+	}
+	q := req.Question[0]
+	name := canonical(q.Name)
+	zone, ok := b.zoneFor(name)
+	if !ok {
+		m.SetRcode(req, dns.RcodeRefused)
+		log.Info("refusing query outside served zones", "name", q.Name)
+		return
+	}
+	m.Authoritative = true
 
-	if requestCount[req.Question[0].Name] < len(b.TxtRecords[req.Question[0].Name]) {
-		// TODO: investigate why this is needed.  It seems that the object isn't being released between tests
-		if requestCount[req.Question[0].Name] == 3 {
-			requestCount[req.Question[0].Name] = 0
+	switch {
+	case q.Qtype == dns.TypeSOA && name == zone:
+		m.Answer = append(m.Answer, soa(zone))
+	case q.Qtype == dns.TypeNS && name == zone:
+		m.Answer = append(m.Answer, &dns.NS{
+			Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: defaultTTL},
+			Ns:  "ns1." + zone,
+		})
+	case q.Qtype == dns.TypeTXT && b.Records != nil:
+		for _, value := range b.Records.TXT(name) {
+			m.Answer = append(m.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: defaultTTL},
+				Txt: []string{value},
+			})
 		}
+	}
 
-		for _, record := range b.TxtRecords[req.Question[0].Name][requestCount[req.Question[0].Name]] {
-			fmt.Println("for loop")
-			txtRR, _ := dns.NewRR(fmt.Sprintf("%s %d IN TXT %s", req.Question[0].Name, defaultTTL, record))
-			m.Answer = append(m.Answer, txtRR)
+	if len(m.Answer) == 0 {
+		// the apex always exists; any other name only exists while it has
+		// TXT records
+		if name != zone && (b.Records == nil || len(b.Records.TXT(name)) == 0) {
+			m.Rcode = dns.RcodeNameError
 		}
-		requestCount[req.Question[0].Name]++
+		m.Ns = append(m.Ns, soa(zone))
 	}
 
 	for _, rr := range m.Answer {
 		log.Info("responding", "response", rr.String())
 	}
-	count++
+}
+
+// zoneFor returns the most specific zone that name is within
+func (b *DNSHandler) zoneFor(name string) (string, bool) {
+	best := ""
+	for _, z := range b.Zones {
+		zone := canonical(z)
+		if (name == zone || strings.HasSuffix(name, "."+zone)) && len(zone) > len(best) {
+			best = zone
+		}
+	}
+	return best, best != ""
+}
+
+func soa(zone string) dns.RR {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: defaultTTL},
+		Ns:      "ns1." + zone,
+		Mbox:    "hostmaster." + zone,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  defaultTTL,
+	}
+}
+
+// canonical lower-cases a DNS name and makes it fully qualified
+func canonical(name string) string {
+	return dns.Fqdn(strings.ToLower(name))
 }
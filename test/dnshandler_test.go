@@ -0,0 +1,109 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jetstack/cert-manager/pkg/issuer/acme/dns/util"
+	logf "github.com/jetstack/cert-manager/pkg/logs"
+	"github.com/jetstack/cert-manager/test/acme/dns/server"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func runServer(t *testing.T, records TXTSource) (string, func()) {
+	ctx := logf.NewContext(context.Background(), nil, t.Name())
+	srv := &server.BasicServer{
+		Handler: &DNSHandler{
+			Log:     logf.FromContext(ctx, "dnsBasicServer"),
+			Zones:   []string{"example.com.", "sub.example.org."},
+			Records: records,
+		},
+	}
+	if err := srv.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return srv.ListenAddr(), func() { srv.Shutdown() }
+}
+
+func query(t *testing.T, addr, name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	r, _, err := new(dns.Client).Exchange(m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestDNSHandler(t *testing.T) {
+	records := &TXTRecords{}
+	addr, shutdown := runServer(t, records)
+	defer shutdown()
+
+	r := query(t, addr, "example.com.", dns.TypeSOA)
+	assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+	assert.True(t, r.Authoritative)
+	if assert.Len(t, r.Answer, 1) {
+		assert.Equal(t, dns.TypeSOA, r.Answer[0].Header().Rrtype)
+	}
+
+	r = query(t, addr, "sub.example.org.", dns.TypeNS)
+	if assert.Len(t, r.Answer, 1) {
+		assert.Equal(t, "ns1.sub.example.org.", r.Answer[0].(*dns.NS).Ns)
+	}
+
+	r = query(t, addr, "_acme-challenge.example.com.", dns.TypeTXT)
+	assert.Equal(t, dns.RcodeNameError, r.Rcode)
+	assert.Len(t, r.Ns, 1, "negative answers should carry the zone's SOA")
+
+	records.Add("_acme-challenge.Example.com.", "one")
+	records.Add("_acme-challenge.example.com", "two")
+	r = query(t, addr, "_ACME-challenge.example.com.", dns.TypeTXT)
+	assert.Equal(t, dns.RcodeSuccess, r.Rcode)
+	assert.Len(t, r.Answer, 2)
+
+	records.Remove("_acme-challenge.example.com.", "one")
+	r = query(t, addr, "_acme-challenge.example.com.", dns.TypeTXT)
+	if assert.Len(t, r.Answer, 1) {
+		assert.Equal(t, []string{"two"}, r.Answer[0].(*dns.TXT).Txt)
+	}
+
+	r = query(t, addr, "example.com.", dns.TypeTXT)
+	assert.Equal(t, dns.RcodeSuccess, r.Rcode, "the apex exists even without TXT records")
+	assert.Empty(t, r.Answer)
+
+	r = query(t, addr, "example.net.", dns.TypeTXT)
+	assert.Equal(t, dns.RcodeRefused, r.Rcode)
+}
+
+func TestDNSHandlerPropagationCheck(t *testing.T) {
+	records := &TXTRecords{}
+	addr, shutdown := runServer(t, records)
+	defer shutdown()
+
+	fqdn := "_acme-challenge.www.example.com."
+	ok, err := util.PreCheckDNS(fqdn, "123d==", []string{addr}, false)
+	assert.NoError(t, err)
+	assert.False(t, ok, "the record shouldn't be visible before it's written")
+
+	records.Add(fqdn, "123d==")
+	ok, err = util.PreCheckDNS(fqdn, "123d==", []string{addr}, false)
+	assert.NoError(t, err)
+	assert.True(t, ok, "the record should be visible once written")
+
+	zone, err := util.FindZoneByFqdn(fqdn, []string{addr})
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com.", zone)
+}
+
+func TestTXTRecordsRemove(t *testing.T) {
+	records := &TXTRecords{}
+	records.Remove("_acme-challenge.example.com.", "123d==")
+	assert.Empty(t, records.TXT("_acme-challenge.example.com."), "removing from empty records shouldn't panic")
+
+	records.Add("_acme-challenge.example.com.", "123d==")
+	records.Add("_acme-challenge.example.com.", "other")
+	records.Remove("_ACME-Challenge.example.com", "123d==")
+	assert.Equal(t, []string{"other"}, records.TXT("_acme-challenge.example.com."))
+}
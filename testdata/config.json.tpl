@@ -1,4 +1,4 @@
 {
-  "APIKey": "{DYNU_APIKEY}",
-  "TTL": 60
+  "apiKey": "{DYNU_APIKEY}",
+  "ttl": 60
 }
\ No newline at end of file
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the solver's spans
+const tracerName = "github.com/gstore/cert-manager-webhook-dynu"
+
+// Span attributes describing the challenge being solved
+const (
+	attrChallengeUID = attribute.Key("cert_manager.challenge.uid")
+	attrDNSName      = attribute.Key("cert_manager.challenge.dns_name")
+	attrResolvedFQDN = attribute.Key("cert_manager.challenge.resolved_fqdn")
+)
+
+// defaultOTLPTarget and defaultOTLPPath make up the OTLP/HTTP traces
+// endpoint used when none is configured
+const (
+	defaultOTLPTarget = "http://localhost:4318"
+	defaultOTLPPath   = "/v1/traces"
+)
+
+// tracingConfig is the OTLP exporter configuration read from the standard
+// OTEL_* environment variables
+type tracingConfig struct {
+	endpoint string
+	headers  map[string]string
+	timeout  time.Duration
+}
+
+// tracingConfigFromEnv reads the exporter settings. Tracing is off unless
+// an OTLP endpoint is configured or OTEL_TRACES_EXPORTER is otlp, and
+// OTEL_SDK_DISABLED or OTEL_TRACES_EXPORTER=none turn it off regardless.
+func tracingConfigFromEnv(getenv func(string) string) (*tracingConfig, error) {
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") {
+		return nil, nil
+	}
+	// first set variable wins, so signal specific ones go first
+	env := func(names ...string) string {
+		for _, name := range names {
+			if v := getenv(name); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	endpoint := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + defaultOTLPPath
+		}
+	}
+	switch exporter := getenv("OTEL_TRACES_EXPORTER"); exporter {
+	case "none":
+		return nil, nil
+	case "otlp":
+		if endpoint == "" {
+			endpoint = defaultOTLPTarget + defaultOTLPPath
+		}
+	case "":
+		if endpoint == "" {
+			return nil, nil
+		}
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_EXPORTER=%s is not supported, only otlp is", exporter)
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP traces endpoint %q", endpoint)
+	}
+	switch protocol := env("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"); protocol {
+	case "", "http/json":
+	case "http/protobuf":
+		// the spec's default, and what many setups set explicitly; OTLP/HTTP
+		// receivers accept JSON on the same endpoint
+		logger.Info("OTLP protocol http/protobuf is not supported, sending traces as http/json instead", "endpoint", endpoint)
+	default:
+		return nil, fmt.Errorf("OTLP protocol %s is not supported, only http/json is", protocol)
+	}
+
+	cfg := &tracingConfig{endpoint: endpoint, headers: map[string]string{}, timeout: 10 * time.Second}
+	// signal specific headers are added to the general ones
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		for _, header := range strings.Split(getenv(name), ",") {
+			if strings.TrimSpace(header) == "" {
+				continue
+			}
+			kv := strings.SplitN(header, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid header %q in %s", header, name)
+			}
+			value, err := url.QueryUnescape(strings.TrimSpace(kv[1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid header %q in %s: %v", header, name, err)
+			}
+			cfg.headers[strings.TrimSpace(kv[0])] = value
+		}
+	}
+	if v := env("OTEL_EXPORTER_OTLP_TRACES_TIMEOUT", "OTEL_EXPORTER_OTLP_TIMEOUT"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return nil, fmt.Errorf("invalid OTLP timeout %q, must be a positive number of milliseconds", v)
+		}
+		cfg.timeout = time.Duration(ms) * time.Millisecond
+	}
+	return cfg, nil
+}
+
+// setupTracing installs a tracer provider exporting spans over OTLP, if
+// the environment configures it. The returned function flushes and stops
+// it; it is nil when tracing is off.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	cfg, err := tracingConfigFromEnv(os.Getenv)
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceNameKey.String("cert-manager-webhook-dynu")),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	exporter := &otlpExporter{
+		endpoint: cfg.endpoint,
+		headers:  cfg.headers,
+		client:   &http.Client{Timeout: cfg.timeout},
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// startChallengeSpan starts the span of a Present or CleanUp call
+func startChallengeSpan(ctx context.Context, name string, ch *v1alpha1.ChallengeRequest) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(
+		attrChallengeUID.String(string(ch.UID)),
+		attrDNSName.String(ch.DNSName),
+		attrResolvedFQDN.String(ch.ResolvedFQDN),
+	))
+}
+
+// endSpan records err on span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
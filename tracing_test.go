@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynuclient"
+	"github.com/gstore/cert-manager-webhook-dynu/dynutest"
+	"github.com/jetstack/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+// recordSpans installs a tracer provider keeping spans in memory for the
+// rest of the test
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+	return exporter
+}
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracing(t *testing.T) {
+	exporter := recordSpans(t)
+	api := dynutest.NewServer("test-api-key", "example.com")
+	defer api.Close()
+
+	solver := &dynuProviderSolver{challenges: newChallengeStore(nil), limiter: unlimited}
+	ch := &v1alpha1.ChallengeRequest{
+		UID:          "challenge-uid",
+		DNSName:      "www.example.com",
+		ResolvedFQDN: "_acme-challenge.www.example.com.",
+		ResolvedZone: "example.com.",
+		Key:          "123d==",
+		Config:       &extapi.JSON{Raw: []byte(fmt.Sprintf(`{"apiKey": %q, "apiBaseURL": %q}`, api.APIKey, api.URL))},
+	}
+	assert.NoError(t, solver.Present(ch))
+
+	spans := exporter.GetSpans()
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	present, ok := byName["Present"]
+	if !assert.True(t, ok, "Present should have a span") {
+		return
+	}
+	domainID := api.Domains()[0].ID
+	attrs := spanAttributes(present)
+	assert.Equal(t, "challenge-uid", attrs[attrChallengeUID].AsString())
+	assert.Equal(t, "www.example.com", attrs[attrDNSName].AsString())
+	assert.Equal(t, int64(domainID), attrs[dynuclient.AttrDomainID].AsInt64())
+
+	for _, name := range []string{"dynu.ResolveZone", "dynu.CreateDNSRecord", "HTTP GET /dns/getroot/{hostname}", "HTTP POST /dns/{id}/record"} {
+		span, ok := byName[name]
+		if assert.True(t, ok, "missing span %s", name) {
+			assert.Equal(t, present.SpanContext.TraceID(), span.SpanContext.TraceID(), "%s should be part of the Present trace", name)
+		}
+	}
+	create := byName["dynu.CreateDNSRecord"]
+	assert.Equal(t, present.SpanContext.SpanID(), create.Parent.SpanID())
+	assert.Equal(t, int64(domainID), spanAttributes(create)[dynuclient.AttrDomainID].AsInt64())
+	assert.Equal(t, int64(api.Records()[0].ID), spanAttributes(create)[dynuclient.AttrRecordID].AsInt64())
+
+	exporter.Reset()
+	ch.Config = &extapi.JSON{Raw: []byte(fmt.Sprintf(`{"apiKey": "wrong", "apiBaseURL": %q}`, api.URL))}
+	assert.Error(t, solver.CleanUp(ch))
+	spans = exporter.GetSpans()
+	if assert.NotEmpty(t, spans) {
+		cleanUp := spans[len(spans)-1]
+		assert.Equal(t, "CleanUp", cleanUp.Name)
+		assert.Equal(t, "Error", cleanUp.Status.Code.String(), "a failed CleanUp should be marked as an error")
+		assert.NotEmpty(t, cleanUp.Events, "the error should be recorded")
+	}
+}
+
+func TestTracingConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want *tracingConfig
+		err  bool
+	}{
+		{name: "off by default", env: map[string]string{}},
+		{
+			name: "endpoint",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318/"},
+			want: &tracingConfig{endpoint: "http://collector:4318/v1/traces", headers: map[string]string{}, timeout: 10 * time.Second},
+		},
+		{
+			name: "traces endpoint is used as is",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "http://collector:4318",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "https://traces.example.com/otlp",
+				"OTEL_EXPORTER_OTLP_HEADERS":         "api-key=secret%3D,tenant=a",
+				"OTEL_EXPORTER_OTLP_TRACES_HEADERS":  "tenant=b",
+				"OTEL_EXPORTER_OTLP_TIMEOUT":         "2500",
+			},
+			want: &tracingConfig{
+				endpoint: "https://traces.example.com/otlp",
+				headers:  map[string]string{"api-key": "secret=", "tenant": "b"},
+				timeout:  2500 * time.Millisecond,
+			},
+		},
+		{
+			name: "exporter without endpoint",
+			env:  map[string]string{"OTEL_TRACES_EXPORTER": "otlp"},
+			want: &tracingConfig{endpoint: "http://localhost:4318/v1/traces", headers: map[string]string{}, timeout: 10 * time.Second},
+		},
+		{name: "exporter none", env: map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}},
+		{name: "sdk disabled", env: map[string]string{"OTEL_SDK_DISABLED": "true", "OTEL_TRACES_EXPORTER": "otlp"}},
+		{name: "other exporter", env: map[string]string{"OTEL_TRACES_EXPORTER": "jaeger"}, err: true},
+		{name: "grpc", env: map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"}, err: true},
+		{
+			name: "protobuf falls back to json",
+			env:  map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "http/protobuf"},
+			want: &tracingConfig{endpoint: "http://localhost:4318/v1/traces", headers: map[string]string{}, timeout: 10 * time.Second},
+		},
+		{name: "bad endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4318"}, err: true},
+		{name: "bad header", env: map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_EXPORTER_OTLP_HEADERS": "api-key"}, err: true},
+		{name: "bad timeout", env: map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_EXPORTER_OTLP_TIMEOUT": "10s"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tracingConfigFromEnv(func(name string) string { return tt.env[name] })
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, cfg)
+		})
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		body    []byte
+		headers http.Header
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ = ioutil.ReadAll(req.Body)
+		headers = req.Header
+	}))
+	defer collector.Close()
+
+	memory := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(memory))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	_, child := provider.Tracer("test").Start(ctx, "child", trace.WithAttributes(
+		dynuclient.AttrDomainID.Int(98765),
+		attribute.Bool("cached", true),
+		attribute.StringSlice("names", []string{"a", "b"}),
+	))
+	endSpan(child, errors.New("boom"))
+	parent.End()
+
+	exporter := &otlpExporter{endpoint: collector.URL + "/v1/traces", headers: map[string]string{"api-key": "secret"}, client: collector.Client()}
+	assert.NoError(t, exporter.ExportSpans(context.Background(), memory.GetSpans().Snapshots()))
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+	assert.Equal(t, "secret", headers.Get("api-key"))
+
+	var data otlpTraceData
+	if !assert.NoError(t, json.Unmarshal(body, &data)) || !assert.Len(t, data.ResourceSpans, 1) || !assert.Len(t, data.ResourceSpans[0].ScopeSpans, 1) {
+		return
+	}
+	scope := data.ResourceSpans[0].ScopeSpans[0]
+	assert.Equal(t, "test", scope.Scope.Name)
+	if !assert.Len(t, scope.Spans, 2) {
+		return
+	}
+	span := scope.Spans[0]
+	childContext := child.SpanContext()
+	traceID, spanID := childContext.TraceID(), childContext.SpanID()
+	parentID := parent.SpanContext().SpanID()
+	assert.Equal(t, "child", span.Name)
+	assert.Equal(t, traceID.String(), span.TraceID)
+	assert.Equal(t, spanID.String(), span.SpanID)
+	assert.Equal(t, parentID.String(), span.ParentSpanID)
+	assert.Equal(t, otlpStatus{Code: otlpStatusError, Message: "boom"}, span.Status)
+	if assert.Len(t, span.Attributes, 3) {
+		assert.Equal(t, "98765", *span.Attributes[0].Value.IntValue)
+		assert.True(t, *span.Attributes[1].Value.BoolValue)
+		assert.Len(t, span.Attributes[2].Value.ArrayValue.Values, 2)
+	}
+	if assert.Len(t, span.Events, 1) {
+		assert.Equal(t, "exception", span.Events[0].Name)
+	}
+	assert.Empty(t, scope.Spans[1].ParentSpanID)
+
+	collector.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	})
+	err := exporter.ExportSpans(context.Background(), memory.GetSpans().Snapshots())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "quota exceeded")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gstore/cert-manager-webhook-dynu/dynuclient"
+)
+
+// defaultDynuHTTPClient sends the Dynu API requests of a solver that hasn't
+// been initialized, with a client span for each of them
+var defaultDynuHTTPClient = &http.Client{Transport: dynuclient.NewTransport(nil), Timeout: dynuclient.DefaultTimeout}
+
+// httpClientConfig tunes the HTTP client all Dynu API requests share
+type httpClientConfig struct {
+	// timeout bounds each request, including reading the response
+	timeout time.Duration
+	// caFile names a PEM bundle of CAs to trust besides the system ones
+	caFile string
+	// maxIdleConns is how many idle connections to Dynu are kept open
+	maxIdleConns int
+	// maxConnsPerHost limits the connections per host; 0 means no limit
+	maxConnsPerHost int
+	// idleConnTimeout is how long an idle connection is kept open
+	idleConnTimeout time.Duration
+}
+
+// newDynuHTTPClient builds the HTTP client for the Dynu API. Requests go
+// through the proxy HTTPS_PROXY, HTTP_PROXY and NO_PROXY select, and are
+// traced.
+func newDynuHTTPClient(cfg httpClientConfig) (*http.Client, error) {
+	if cfg.timeout <= 0 {
+		return nil, fmt.Errorf("Dynu HTTP timeout must be greater than 0, got %v", cfg.timeout)
+	}
+	if cfg.maxIdleConns < 0 || cfg.maxConnsPerHost < 0 || cfg.idleConnTimeout < 0 {
+		return nil, fmt.Errorf("Dynu connection limits must not be negative")
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.caFile != "" {
+		pem, err := ioutil.ReadFile(cfg.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading Dynu CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in Dynu CA bundle %s", cfg.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          cfg.maxIdleConns,
+		MaxIdleConnsPerHost:   cfg.maxIdleConns,
+		MaxConnsPerHost:       cfg.maxConnsPerHost,
+		IdleConnTimeout:       cfg.idleConnTimeout,
+	}
+	return &http.Client{Transport: dynuclient.NewTransport(transport), Timeout: cfg.timeout}, nil
+}
+
+// dynuHTTPClient returns the HTTP client for a new DynuClient
+func (c *dynuProviderSolver) dynuHTTPClient() *http.Client {
+	if c.httpClient != nil {
+		return c.httpClient
+	}
+	return defaultDynuHTTPClient
+}
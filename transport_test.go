@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDynuHTTPClient(t *testing.T) {
+	api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	cfg := httpClientConfig{timeout: 5 * time.Second, maxIdleConns: 2, idleConnTimeout: time.Minute}
+
+	client, err := newDynuHTTPClient(cfg)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5*time.Second, client.Timeout)
+		_, err = client.Get(api.URL)
+		assert.Error(t, err, "the test server's certificate shouldn't be trusted without the CA file")
+	}
+
+	dir := t.TempDir()
+	cfg.caFile = filepath.Join(dir, "ca.crt")
+	assert.NoError(t, ioutil.WriteFile(cfg.caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: api.Certificate().Raw}), 0600))
+	client, err = newDynuHTTPClient(cfg)
+	if assert.NoError(t, err) {
+		resp, err := client.Get(api.URL)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+		}
+	}
+
+	invalid := filepath.Join(dir, "invalid.crt")
+	assert.NoError(t, ioutil.WriteFile(invalid, []byte("not a certificate"), 0600))
+	for name, cfg := range map[string]httpClientConfig{
+		"no timeout":      {},
+		"negative limit":  {timeout: time.Second, maxConnsPerHost: -1},
+		"missing CA file": {timeout: time.Second, caFile: filepath.Join(dir, "missing.crt")},
+		"invalid CA file": {timeout: time.Second, caFile: invalid},
+	} {
+		_, err := newDynuHTTPClient(cfg)
+		assert.Error(t, err, name)
+	}
+}